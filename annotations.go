@@ -0,0 +1,76 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// maxShortDescription matches the length limit of short descriptions on
+// Docker Hub.
+const maxShortDescription = 100
+
+// mergeAnnotations returns the metadata annotations of an image. Sources are
+// applied in increasing order of precedence:
+//
+//  1. labels of the image config
+//  2. annotations of the descriptor pointing to the manifest (e.g. in an index)
+//  3. annotations of the manifest itself
+func mergeAnnotations(labels map[string]string, mfst manifest) map[string]string {
+	annotations := make(map[string]string, len(labels)+len(mfst.desc.Annotations)+len(mfst.manifest.Annotations))
+	for _, m := range []map[string]string{labels, mfst.desc.Annotations, mfst.manifest.Annotations} {
+		for k, v := range m {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
+
+func addAnnotations(img *Image, annotations map[string]string) {
+	for key, field := range map[string]*string{
+		AnnotationImageTitle:            &img.Title,
+		ocispec.AnnotationAuthors:       &img.Author,
+		ocispec.AnnotationVendor:        &img.Vendor,
+		ocispec.AnnotationURL:           &img.URL,
+		ocispec.AnnotationSource:        &img.Source,
+		ocispec.AnnotationRevision:      &img.Revision,
+		ocispec.AnnotationDocumentation: &img.Documentation,
+		ocispec.AnnotationDescription:   &img.Description,
+		ocispec.AnnotationLicenses:      &img.License,
+	} {
+		if v, ok := annotations[key]; ok {
+			*field = v
+		}
+	}
+
+	if img.Description != "" {
+		img.ShortDescription = shortDescription(img.Description)
+	}
+}
+
+// shortDescription returns the first line of the description, truncated to
+// maxShortDescription characters.
+func shortDescription(desc string) string {
+	desc = strings.TrimSpace(desc)
+	if i := strings.IndexByte(desc, '\n'); i >= 0 {
+		desc = strings.TrimSpace(desc[:i])
+	}
+	if r := []rune(desc); len(r) > maxShortDescription {
+		desc = string(r[:maxShortDescription-3]) + "..."
+	}
+	return desc
+}
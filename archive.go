@@ -0,0 +1,360 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	distref "github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// annotationGeneratedManifest is set by resolvers on the descriptors of the
+// manifests they generated.
+const annotationGeneratedManifest = "com.docker.imageinspect.generated-manifest"
+
+type archiveEntry struct {
+	offset int64
+	size   int64
+}
+
+// archiveStore gives access to the files of an uncompressed tar archive
+// without extracting it.
+type archiveStore struct {
+	f       *os.File
+	entries map[string]archiveEntry
+}
+
+func newArchiveStore(f *os.File) (*archiveStore, error) {
+	var magic [2]byte
+	if _, err := f.ReadAt(magic[:], 0); err == nil && magic == [2]byte{0x1f, 0x8b} {
+		return nil, errors.New("compressed archives are not supported, decompress the archive first")
+	}
+
+	s := &archiveStore{
+		f:       f,
+		entries: map[string]archiveEntry{},
+	}
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		s.entries[path.Clean(strings.TrimPrefix(hdr.Name, "./"))] = archiveEntry{
+			offset: offset,
+			size:   hdr.Size,
+		}
+	}
+	return s, nil
+}
+
+func (s *archiveStore) Open(name string) (io.ReadCloser, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, errors.Wrapf(errdefs.ErrNotFound, "%s not found in archive", name)
+	}
+	return io.NopCloser(io.NewSectionReader(s.f, e.offset, e.size)), nil
+}
+
+func (s *archiveStore) has(name string) bool {
+	_, ok := s.entries[name]
+	return ok
+}
+
+// dockerArchiveManifest is an entry of manifest.json in archives written by
+// "docker save".
+type dockerArchiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// ArchiveResolver resolves references against a tar archive written by
+// "docker save" or an OCI image layout archive, as written by
+// "buildx build --output type=oci".
+//
+// Archives holding an index.json, such as OCI archives and the archives
+// written by "docker save" since Docker 25, are resolved as with
+// LayoutResolver, which gives the same Result as the pushed image.
+//
+// Older "docker save" archives carry no manifests, so an image manifest is
+// generated for every image from its config and layers, and tags are
+// resolved from manifest.json and the legacy repositories file. The layers of
+// these archives are stored uncompressed, so the digest of the generated
+// manifest and the digests and sizes of its layers don't match the pushed
+// image. Result.GeneratedManifest is set for these images.
+//
+// The archive is read in place and must not be compressed.
+type ArchiveResolver struct {
+	f     *os.File
+	store *archiveStore
+
+	layout *LayoutResolver
+
+	tags  map[string]digest.Digest
+	blobs map[digest.Digest]string
+	mfsts map[digest.Digest][]byte
+}
+
+var _ remotes.Resolver = &ArchiveResolver{}
+
+// NewArchiveResolver opens the archive at p. The archive is kept open until
+// Close is called.
+func NewArchiveResolver(p string) (_ *ArchiveResolver, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+
+	store, err := newArchiveStore(f)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ArchiveResolver{
+		f:     f,
+		store: store,
+	}
+
+	if store.has("index.json") {
+		if store.has(ocispec.ImageLayoutFile) {
+			r.layout, err = newLayoutResolver(store)
+		} else {
+			r.layout, err = newIndexResolver(store)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	if !store.has("manifest.json") {
+		return nil, errors.New("archive is neither an oci layout nor a docker image archive")
+	}
+	if err := r.loadDockerArchive(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *ArchiveResolver) Close() error {
+	return r.f.Close()
+}
+
+func (r *ArchiveResolver) loadDockerArchive() error {
+	var items []dockerArchiveManifest
+	if err := readLayoutJSON(r.store, "manifest.json", &items); err != nil {
+		return err
+	}
+
+	r.tags = map[string]digest.Digest{}
+	r.blobs = map[digest.Digest]string{}
+	r.mfsts = map[digest.Digest][]byte{}
+
+	// layer IDs of legacy v1 images, used by the repositories file
+	layerIDs := map[string]digest.Digest{}
+
+	for _, item := range items {
+		config, err := r.blobDescriptor(item.Config, images.MediaTypeDockerSchema2Config)
+		if err != nil {
+			return err
+		}
+
+		mfst := ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: images.MediaTypeDockerSchema2Manifest,
+			Config:    config,
+			Layers:    make([]ocispec.Descriptor, len(item.Layers)),
+		}
+		for i, l := range item.Layers {
+			mt, err := r.layerMediaType(l)
+			if err != nil {
+				return err
+			}
+			mfst.Layers[i], err = r.blobDescriptor(l, mt)
+			if err != nil {
+				return err
+			}
+		}
+
+		dt, err := json.Marshal(mfst)
+		if err != nil {
+			return err
+		}
+		dgst := digest.FromBytes(dt)
+		r.mfsts[dgst] = dt
+
+		for _, tag := range item.RepoTags {
+			named, err := parseReference(tag)
+			if err != nil {
+				return err
+			}
+			r.tags[named.String()] = dgst
+		}
+		if n := len(item.Layers); n > 0 {
+			layerIDs[path.Dir(item.Layers[n-1])] = dgst
+		}
+	}
+
+	if !r.store.has("repositories") {
+		return nil
+	}
+
+	var repos map[string]map[string]string
+	if err := readLayoutJSON(r.store, "repositories", &repos); err != nil {
+		return err
+	}
+	for repo, tags := range repos {
+		for tag, id := range tags {
+			dgst, ok := layerIDs[id]
+			if !ok {
+				continue
+			}
+			named, err := parseReference(repo + ":" + tag)
+			if err != nil {
+				return err
+			}
+			if _, ok := r.tags[named.String()]; !ok {
+				r.tags[named.String()] = dgst
+			}
+		}
+	}
+	return nil
+}
+
+// blobDescriptor returns the descriptor of the archive file name, computing
+// its digest unless the file is stored by digest.
+func (r *ArchiveResolver) blobDescriptor(name string, mediaType string) (ocispec.Descriptor, error) {
+	name = path.Clean(name)
+	e, ok := r.store.entries[name]
+	if !ok {
+		return ocispec.Descriptor{}, errors.Wrapf(errdefs.ErrNotFound, "%s not found in archive", name)
+	}
+
+	dgst, err := digest.Parse(strings.Replace(strings.TrimPrefix(name, "blobs/"), "/", ":", 1))
+	if err != nil {
+		rc, err := r.store.Open(name)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		dgst, err = digest.FromReader(rc)
+		rc.Close()
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+
+	r.blobs[dgst] = name
+	return ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      e.size,
+	}, nil
+}
+
+func (r *ArchiveResolver) layerMediaType(name string) (string, error) {
+	rc, err := r.store.Open(path.Clean(name))
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var magic [2]byte
+	if _, err := io.ReadFull(rc, magic[:]); err == nil && magic == [2]byte{0x1f, 0x8b} {
+		return images.MediaTypeDockerSchema2LayerGzip, nil
+	}
+	return images.MediaTypeDockerSchema2Layer, nil
+}
+
+func (r *ArchiveResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	if r.layout != nil {
+		return r.layout.Resolve(ctx, ref)
+	}
+
+	named, err := parseReference(ref)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	dgst, ok := r.tags[named.String()]
+	if canonical, isCanonical := named.(distref.Canonical); isCanonical {
+		dgst = canonical.Digest()
+		_, ok = r.mfsts[dgst]
+	}
+	if !ok {
+		return "", ocispec.Descriptor{}, errors.Wrapf(errdefs.ErrNotFound, "reference %s not found in archive", ref)
+	}
+
+	return ref, ocispec.Descriptor{
+		MediaType: images.MediaTypeDockerSchema2Manifest,
+		Digest:    dgst,
+		Size:      int64(len(r.mfsts[dgst])),
+		Annotations: map[string]string{
+			annotationGeneratedManifest: "true",
+		},
+	}, nil
+}
+
+func (r *ArchiveResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	return r, nil
+}
+
+func (r *ArchiveResolver) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	if r.layout != nil {
+		return r.layout.Fetch(ctx, desc)
+	}
+	if dt, ok := r.mfsts[desc.Digest]; ok {
+		return io.NopCloser(bytes.NewReader(dt)), nil
+	}
+	name, ok := r.blobs[desc.Digest]
+	if !ok {
+		return nil, errors.Wrapf(errdefs.ErrNotFound, "blob %s not found in archive", desc.Digest)
+	}
+	return r.store.Open(name)
+}
+
+func (r *ArchiveResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	return nil, errors.Wrap(errdefs.ErrNotImplemented, "pushing to archive is not supported")
+}
@@ -0,0 +1,260 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/go-imageinspect/testutil"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOCIArchive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Architecture: "arm64",
+		OS:           "linux",
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: []ocispec.Descriptor{
+			{Size: 100},
+		},
+		Annotations: map[string]string{
+			"org.opencontainers.image.title": "this is title",
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	stmt, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+		"builder": map[string]string{"id": "https://example.com/builder"},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(stmt)
+	require.NoError(t, err)
+
+	att, err := testutil.AttestationManifest(mfst.Descriptor, stmt.Descriptor)
+	require.NoError(t, err)
+	_, err = env.AddBlob(att)
+	require.NoError(t, err)
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			mfst.Descriptor,
+			att.Descriptor,
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	expected, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	files, err := testutil.LayoutFiles(ocispec.Index{
+		Manifests: []ocispec.Descriptor{idx.Descriptor},
+	}, cfg, mfst, stmt, att, idx)
+	require.NoError(t, err)
+
+	p := filepath.Join(t.TempDir(), "oci.tar")
+	require.NoError(t, testutil.WriteArchive(p, files))
+
+	resolver, err := NewArchiveResolver(p)
+	require.NoError(t, err)
+	defer resolver.Close()
+
+	l, err = NewLoader(Opt{
+		Resolver: resolver,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	require.Equal(t, expected, r)
+	require.NotNil(t, r.Images["linux/arm64"].Provenance)
+}
+
+func TestDockerArchive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Architecture: "arm64",
+		OS:           "linux",
+		Config: ocispec.ImageConfig{
+			Labels: map[string]string{
+				"org.opencontainers.image.title": "this is title",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	layer := make([]byte, 1024)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err = zw.Write(layer)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	pushed, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: []ocispec.Descriptor{{
+			MediaType: ocispec.MediaTypeImageLayerGzip,
+			Digest:    digest.FromBytes(gz.Bytes()),
+			Size:      int64(gz.Len()),
+		}},
+	})
+	require.NoError(t, err)
+
+	manifest, err := json.Marshal([]map[string]interface{}{
+		{
+			"Config":   cfg.Descriptor.Digest.Hex() + ".json",
+			"RepoTags": []string{"test:v1"},
+			"Layers":   []string{"abc/layer.tar"},
+		},
+	})
+	require.NoError(t, err)
+
+	repositories, err := json.Marshal(map[string]map[string]string{
+		"test": {"v2": "abc"},
+	})
+	require.NoError(t, err)
+
+	p := filepath.Join(t.TempDir(), "docker.tar")
+	require.NoError(t, testutil.WriteArchive(p, map[string][]byte{
+		"manifest.json":                       manifest,
+		"repositories":                        repositories,
+		cfg.Descriptor.Digest.Hex() + ".json": cfg.Data,
+		"abc/layer.tar":                       layer,
+	}))
+
+	resolver, err := NewArchiveResolver(p)
+	require.NoError(t, err)
+	defer resolver.Close()
+
+	l, err := NewLoader(Opt{
+		Resolver: resolver,
+	})
+	require.NoError(t, err)
+
+	for _, ref := range []string{"test:v1", "test:v2"} {
+		r, err := l.Load(ctx, ref)
+		require.NoError(t, err)
+
+		require.Equal(t, Manifest, r.ResultType)
+		require.Equal(t, []string{"linux/arm64"}, r.Platforms)
+
+		img, ok := r.Images["linux/arm64"]
+		require.True(t, ok)
+		require.Equal(t, "this is title", img.Title)
+		require.Equal(t, int64(1024), img.Size)
+
+		// the manifest is generated from the uncompressed layers, so it
+		// doesn't match the pushed image
+		require.True(t, r.GeneratedManifest)
+		require.NotEqual(t, pushed.Descriptor.Digest, r.Digest)
+		require.Equal(t, digest.FromBytes(layer), img.Layers[0].Digest)
+	}
+
+	_, err = l.Load(ctx, "test:v3")
+	require.Error(t, err)
+}
+
+func TestDockerArchiveIndex(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Architecture: "arm64",
+		OS:           "linux",
+	})
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: []ocispec.Descriptor{
+			{Size: 100},
+		},
+	})
+	require.NoError(t, err)
+
+	desc := mfst.Descriptor
+	desc.Annotations = map[string]string{
+		"io.containerd.image.name": "docker.io/library/test:v1",
+	}
+	files, err := testutil.LayoutFiles(ocispec.Index{
+		Manifests: []ocispec.Descriptor{desc},
+	}, cfg, mfst)
+	require.NoError(t, err)
+
+	// docker save also writes manifest.json next to index.json, which is
+	// preferred as it holds the pushed manifests
+	delete(files, ocispec.ImageLayoutFile)
+	files["manifest.json"], err = json.Marshal([]map[string]interface{}{
+		{
+			"Config":   "blobs/sha256/" + cfg.Descriptor.Digest.Hex(),
+			"RepoTags": []string{"test:v1"},
+			"Layers":   []string{},
+		},
+	})
+	require.NoError(t, err)
+
+	p := filepath.Join(t.TempDir(), "docker.tar")
+	require.NoError(t, testutil.WriteArchive(p, files))
+
+	resolver, err := NewArchiveResolver(p)
+	require.NoError(t, err)
+	defer resolver.Close()
+
+	l, err := NewLoader(Opt{
+		Resolver: resolver,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test:v1")
+	require.NoError(t, err)
+
+	require.Equal(t, mfst.Descriptor.Digest, r.Digest)
+	require.False(t, r.GeneratedManifest)
+	require.Equal(t, int64(100), r.Images["linux/arm64"].Size)
+}
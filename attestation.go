@@ -0,0 +1,239 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	MediaTypeInToto         = "application/vnd.in-toto+json"
+	MediaTypeSPDX           = "application/spdx+json"
+	MediaTypeSPDXTagValue   = "text/spdx"
+	AnnotationPredicateType = "in-toto.io/predicate-type"
+
+	PredicateSPDX              = "https://spdx.dev/Document"
+	PredicateSLSAProvenanceV02 = slsa02.PredicateSLSAProvenance
+	PredicateSLSAProvenanceV1  = "https://slsa.dev/provenance/v1"
+)
+
+type inTotoStatement struct {
+	intoto.StatementHeader
+	Predicate json.RawMessage `json:"predicate"`
+}
+
+// scanAttestations parses the in-toto statements and SBOM documents stored in
+// the attestation manifests and referrers artifacts referencing subject.
+func (l *Loader) scanAttestations(ctx context.Context, fetcher remotes.Fetcher, r *result, subject digest.Digest, refs []digest.Digest, img *Image) error {
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeInToto, "intoto")
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeSPDX, "spdx")
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeSPDXTagValue, "spdx")
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeCycloneDX, "cyclonedx")
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeDSSE, "dsse")
+
+	for _, dgst := range refs {
+		mfst, ok := r.manifests[dgst]
+		if !ok {
+			err := errors.Errorf("referenced image %s not found", dgst)
+			if err := l.recordError(&img.Errors, ComponentAttestation, dgst, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, layer := range mfst.manifest.Layers {
+			component := ComponentAttestation
+			if strings.HasPrefix(layer.MediaType, MediaTypeSigstoreBundlePrefix) {
+				component = ComponentSignature
+			}
+			if err := l.recordError(&img.Errors, component, layer.Digest, l.scanAttestation(ctx, fetcher, layer, subject, img)); err != nil {
+				return err
+			}
+		}
+	}
+
+	normalizeSBOM(img.SBOM)
+
+	return nil
+}
+
+func (l *Loader) scanAttestation(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor, subject digest.Digest, img *Image) error {
+	if strings.HasPrefix(layer.MediaType, MediaTypeSigstoreBundlePrefix) {
+		return l.scanSigstoreBundle(ctx, fetcher, layer, subject, img)
+	}
+
+	switch layer.MediaType {
+	case MediaTypeInToto:
+		return l.scanStatement(ctx, fetcher, layer, subject, img)
+	case MediaTypeDSSE:
+		return l.scanEnvelope(ctx, fetcher, layer, subject, img)
+	case MediaTypeSPDX, MediaTypeSPDXTagValue:
+		if !l.want(PartSBOM) {
+			return nil
+		}
+		dt, err := l.readBlob(ctx, fetcher, layer)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch attestation %s", layer.Digest)
+		}
+		doc, err := decodeSPDX(dt)
+		if err != nil {
+			return err
+		}
+		addSPDX(img, doc, nil)
+	case MediaTypeCycloneDX:
+		if !l.want(PartSBOM) {
+			return nil
+		}
+		dt, err := l.readBlob(ctx, fetcher, layer)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch attestation %s", layer.Digest)
+		}
+		bom, err := decodeCycloneDX(dt)
+		if err != nil {
+			return err
+		}
+		addCycloneDX(img, bom, nil)
+	}
+	return nil
+}
+
+func (l *Loader) scanStatement(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor, subject digest.Digest, img *Image) error {
+	// referrers artifacts may not carry the predicate type annotation, in
+	// which case the statement has to be read to find it
+	predicateType, ok := layer.Annotations[AnnotationPredicateType]
+	if ok && !l.wantPredicate(predicateType) {
+		return nil
+	}
+
+	stmt, err := l.readStatement(ctx, fetcher, layer, subject)
+	if err != nil {
+		return err
+	}
+
+	if ok && stmt.PredicateType != predicateType {
+		return errors.Errorf("unexpected predicate type %s", stmt.PredicateType)
+	}
+
+	return l.addStatement(img, stmt, nil)
+}
+
+// scanEnvelope adds the in-toto statement wrapped in a DSSE envelope to img,
+// along with the envelope signatures verified with the configured keys.
+func (l *Loader) scanEnvelope(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor, subject digest.Digest, img *Image) error {
+	predicateType, ok := layer.Annotations[AnnotationPredicateType]
+	if ok && !l.wantPredicate(predicateType) {
+		return nil
+	}
+
+	dt, err := l.readBlob(ctx, fetcher, layer)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch attestation %s", layer.Digest)
+	}
+
+	env, payload, err := decodeDSSE(dt)
+	if err != nil {
+		return err
+	}
+	if env.PayloadType != MediaTypeInToto {
+		return nil
+	}
+
+	stmt, err := decodeStatement(payload, subject)
+	if err != nil {
+		return err
+	}
+
+	if ok && stmt.PredicateType != predicateType {
+		return errors.Errorf("unexpected predicate type %s", stmt.PredicateType)
+	}
+
+	return l.addStatement(img, stmt, l.verifyDSSE(env, payload, subject, nil))
+}
+
+// addStatement adds the predicate of stmt to img, recording sigs as the
+// signatures of the statement. Statements with unknown predicate types or
+// that aren't part of the loaded parts are ignored.
+func (l *Loader) addStatement(img *Image, stmt *inTotoStatement, sigs []Signature) error {
+	if !l.wantPredicate(stmt.PredicateType) {
+		return nil
+	}
+	switch stmt.PredicateType {
+	case PredicateSPDX:
+		doc, err := decodeSPDX(stmt.Predicate)
+		if err != nil {
+			return err
+		}
+		addSPDX(img, doc, sigs)
+	case PredicateCycloneDX:
+		bom, err := decodeCycloneDX(stmt.Predicate)
+		if err != nil {
+			return err
+		}
+		addCycloneDX(img, bom, sigs)
+	case PredicateSLSAProvenanceV02, PredicateSLSAProvenanceV1:
+		return addProvenanceStatement(img, stmt, sigs)
+	}
+	return nil
+}
+
+func (l *Loader) readBlob(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) ([]byte, error) {
+	_, err := remotes.FetchHandler(l.cache, fetcher)(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	return content.ReadBlob(ctx, l.cache, desc)
+}
+
+func (l *Loader) readStatement(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, subject digest.Digest) (*inTotoStatement, error) {
+	dt, err := l.readBlob(ctx, fetcher, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch attestation %s", desc.Digest)
+	}
+
+	return decodeStatement(dt, subject)
+}
+
+func decodeStatement(dt []byte, subject digest.Digest) (*inTotoStatement, error) {
+	var stmt inTotoStatement
+	if err := json.Unmarshal(dt, &stmt); err != nil {
+		return nil, err
+	}
+
+	if err := validateSubject(stmt.Subject, subject); err != nil {
+		return nil, err
+	}
+	return &stmt, nil
+}
+
+func validateSubject(subjects []intoto.Subject, subject digest.Digest) error {
+	for _, s := range subjects {
+		for alg, hash := range s.Digest {
+			if alg+":"+hash == subject.String() {
+				return nil
+			}
+		}
+	}
+	return errors.Errorf("unable to validate subject %s, expected %s", subjects, subject.String())
+}
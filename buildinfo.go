@@ -15,38 +15,27 @@
 package imageinspect
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"strings"
 
-	"github.com/containerd/containerd/content"
-	"github.com/containerd/containerd/remotes"
 	binfotypes "github.com/moby/buildkit/util/buildinfo/types"
-	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 )
 
-func (l *Loader) scanBuildInfo(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, img *Image) error {
-	_, err := remotes.FetchHandler(l.cache, fetcher)(ctx, desc)
-	if err != nil {
-		return err
-	}
-	dt, err := content.ReadBlob(ctx, l.cache, desc)
-	if err != nil {
-		return err
-	}
-
-	var cfg binfotypes.ImageConfig
-	if err := json.Unmarshal(dt, &cfg); err != nil {
-		return err
+// scanBuildInfo adds the provenance from the legacy BuildKit buildinfo in the
+// image config to img.
+func scanBuildInfo(config *imageConfig, img *Image) error {
+	if img.Provenance != nil {
+		// provenance attestations take precedence over legacy buildinfo
+		return nil
 	}
 
-	if cfg.BuildInfo == "" {
+	if config.BuildInfo == "" {
 		return nil
 	}
 
-	dt, err = base64.StdEncoding.DecodeString(cfg.BuildInfo)
+	dt, err := base64.StdEncoding.DecodeString(config.BuildInfo)
 	if err != nil {
 		return errors.Wrapf(err, "failed to decode buildinfo base64")
 	}
@@ -56,11 +45,8 @@ func (l *Loader) scanBuildInfo(ctx context.Context, fetcher remotes.Fetcher, des
 		return errors.Wrapf(err, "failed to decode buildinfo")
 	}
 
-	p := img.Provenance
-	if p == nil {
-		p = &Provenance{}
-		img.Provenance = p
-	}
+	p := &Provenance{}
+	img.Provenance = p
 
 	if context := bi.Attrs["context"]; context != nil {
 		p.BuildSource = *context
@@ -19,6 +19,7 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/docker/go-imageinspect"
@@ -35,12 +36,89 @@ func main() {
 
 func run() error {
 	opt := imageinspect.Opt{
-		Resolver: docker.NewResolver(docker.ResolverOptions{}), // TODO: auth
+		Resolver: imageinspect.NewRegistryResolver(docker.ResolverOptions{}), // TODO: auth
 	}
 
+	var ociLayout, archive, keyFile, trustedRoot, notationStore, notationPolicy, platformList, parts string
+
 	flag.StringVar(&opt.CacheDir, "cache-dir", "", "cache directory")
+	flag.StringVar(&ociLayout, "oci-layout", "", "read the image from an OCI layout directory")
+	flag.StringVar(&archive, "archive", "", "read the image from a docker save or OCI tar archive")
+	flag.BoolVar(&opt.Cosign, "cosign", false, "discover cosign signatures and attestations")
+	flag.StringVar(&platformList, "platform", "", "comma separated platforms to load from an index")
+	flag.BoolVar(&opt.BestPlatformOnly, "best-platform", false, "only load the best matching platform, the default platform if -platform is not set")
+	flag.StringVar(&parts, "parts", "", "comma separated parts to load: config, layers, sbom, provenance, signatures")
+	flag.BoolVar(&opt.UncompressedSize, "uncompressed-size", false, "fetch the layers to compute their uncompressed size")
+	flag.BoolVar(&opt.Files, "files", false, "fetch the layers to list their files")
+	flag.BoolVar(&opt.Secrets, "secrets", false, "fetch the layers to look for secrets")
+	flag.BoolVar(&opt.Lenient, "lenient", false, "report errors reading attestations and signatures in the result instead of failing")
+	flag.StringVar(&keyFile, "key", "", "PEM file with public keys to verify signatures with")
+	flag.StringVar(&trustedRoot, "trusted-root", "", "sigstore trusted_root.json to verify keyless signatures with")
+	flag.StringVar(&notationStore, "notation-trust-store", "", "notation trust store directory")
+	flag.StringVar(&notationPolicy, "notation-trust-policy", "", "notation trust policy file to verify notation signatures with")
 	flag.Parse()
 
+	if parts != "" {
+		var err error
+		opt.Parts, err = imageinspect.ParseParts(parts)
+		if err != nil {
+			return err
+		}
+	}
+	if platformList != "" {
+		var err error
+		opt.Platforms, err = imageinspect.ParsePlatforms(strings.Split(platformList, ",")...)
+		if err != nil {
+			return err
+		}
+	}
+	if keyFile != "" {
+		dt, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		opt.PublicKeys, err = imageinspect.ParsePublicKeys(dt)
+		if err != nil {
+			return err
+		}
+	}
+	if trustedRoot != "" {
+		dt, err := os.ReadFile(trustedRoot)
+		if err != nil {
+			return err
+		}
+		opt.TrustedRoot, err = imageinspect.ParseTrustedRoot(dt)
+		if err != nil {
+			return err
+		}
+	}
+	if notationPolicy != "" {
+		var err error
+		opt.NotationTrust, err = imageinspect.LoadNotationTrust(notationStore, notationPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ociLayout != "" && archive != "" {
+		return errors.New("-oci-layout and -archive can't be used together")
+	}
+	if ociLayout != "" {
+		resolver, err := imageinspect.NewLayoutResolver(ociLayout)
+		if err != nil {
+			return err
+		}
+		opt.Resolver = resolver
+	}
+	if archive != "" {
+		resolver, err := imageinspect.NewArchiveResolver(archive)
+		if err != nil {
+			return err
+		}
+		defer resolver.Close()
+		opt.Resolver = resolver
+	}
+
 	args := flag.Args()
 
 	if len(args) != 1 {
@@ -0,0 +1,134 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"sort"
+	"time"
+
+	binfotypes "github.com/moby/buildkit/util/buildinfo/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Config is the image configuration used as the base when running a
+// container from the image.
+type Config struct {
+	Created      *time.Time        `json:",omitempty"`
+	User         string            `json:",omitempty"`
+	ExposedPorts []string          `json:",omitempty"`
+	Env          []string          `json:",omitempty"`
+	Entrypoint   []string          `json:",omitempty"`
+	Cmd          []string          `json:",omitempty"`
+	Volumes      []string          `json:",omitempty"`
+	WorkingDir   string            `json:",omitempty"`
+	Labels       map[string]string `json:",omitempty"`
+	StopSignal   string            `json:",omitempty"`
+	Healthcheck  *Healthcheck      `json:",omitempty"`
+	OSVersion    string            `json:",omitempty"`
+	OSFeatures   []string          `json:",omitempty"`
+}
+
+// Healthcheck is the Docker healthcheck of the image, which isn't part of
+// the OCI image config.
+type Healthcheck struct {
+	Test        []string      `json:",omitempty"`
+	Interval    time.Duration `json:",omitempty"`
+	Timeout     time.Duration `json:",omitempty"`
+	StartPeriod time.Duration `json:",omitempty"`
+	Retries     int           `json:",omitempty"`
+}
+
+// History is a step of the image build, from the oldest to the most recent.
+type History struct {
+	Created   *time.Time `json:",omitempty"`
+	CreatedBy string     `json:",omitempty"`
+	Comment   string     `json:",omitempty"`
+	// EmptyLayer is set for steps that didn't create a layer.
+	EmptyLayer bool `json:",omitempty"`
+	// Layer is the digest of the layer created by the step.
+	Layer digest.Digest `json:",omitempty"`
+	// Size is the compressed size of Layer.
+	Size int64
+}
+
+// imageConfig is the image config blob, including the Docker and BuildKit
+// extensions to the OCI image config.
+type imageConfig struct {
+	ocispec.Image
+
+	Config struct {
+		ocispec.ImageConfig
+		Healthcheck *Healthcheck `json:"Healthcheck,omitempty"`
+	} `json:"config,omitempty"`
+
+	binfotypes.ImageConfig
+}
+
+func addConfig(img *Image, config *imageConfig) {
+	c := config.Config
+	img.Config = &Config{
+		Created:      config.Created,
+		User:         c.User,
+		ExposedPorts: sortedKeys(c.ExposedPorts),
+		Env:          c.Env,
+		Entrypoint:   c.Entrypoint,
+		Cmd:          c.Cmd,
+		Volumes:      sortedKeys(c.Volumes),
+		WorkingDir:   c.WorkingDir,
+		Labels:       c.Labels,
+		StopSignal:   c.StopSignal,
+		Healthcheck:  c.Healthcheck,
+		OSVersion:    config.OSVersion,
+		OSFeatures:   config.OSFeatures,
+	}
+}
+
+// addHistory adds the history of the image config to img, lining up the steps
+// that created a layer with the layers of the manifest.
+func addHistory(img *Image, config *imageConfig, layers []ocispec.Descriptor) {
+	if len(config.History) == 0 {
+		return
+	}
+
+	img.History = make([]History, len(config.History))
+	i := 0
+	for j, h := range config.History {
+		img.History[j] = History{
+			Created:    h.Created,
+			CreatedBy:  h.CreatedBy,
+			Comment:    h.Comment,
+			EmptyLayer: h.EmptyLayer,
+		}
+		if h.EmptyLayer || i >= len(layers) {
+			continue
+		}
+		img.History[j].Layer = layers[i].Digest
+		img.History[j].Size = layers[i].Size
+		i++
+	}
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"io"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	distref "github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	"github.com/moby/buildkit/util/imageutil"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ContainerdResolver resolves references against a containerd image store
+// and reads blobs from a containerd content store, without contacting a
+// registry. The context passed to the loader must carry the containerd
+// namespace of the images.
+type ContainerdResolver struct {
+	provider content.Provider
+	images   images.Store
+}
+
+var _ remotes.Resolver = &ContainerdResolver{}
+
+func NewContainerdResolver(provider content.Provider, store images.Store) *ContainerdResolver {
+	return &ContainerdResolver{
+		provider: provider,
+		images:   store,
+	}
+}
+
+func (r *ContainerdResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	named, err := parseReference(ref)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	img, err := r.images.Get(ctx, named.String())
+	if err == nil {
+		return ref, img.Target, nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	canonical, ok := named.(distref.Canonical)
+	if !ok {
+		return "", ocispec.Descriptor{}, errors.Wrapf(err, "image %s not found in containerd image store", named)
+	}
+
+	desc := ocispec.Descriptor{Digest: canonical.Digest()}
+	dt, err := r.readBlob(ctx, desc)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+	mt, err := imageutil.DetectManifestBlobMediaType(dt)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+	desc.MediaType = mt
+	desc.Size = int64(len(dt))
+	return ref, desc, nil
+}
+
+func (r *ContainerdResolver) readBlob(ctx context.Context, desc ocispec.Descriptor) ([]byte, error) {
+	rc, err := r.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (r *ContainerdResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	return r, nil
+}
+
+func (r *ContainerdResolver) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	ra, err := r.provider.ReaderAt(ctx, desc)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "blob %s is missing from the content store, it may have been garbage collected", desc.Digest)
+		}
+		return nil, err
+	}
+	return &readerAtCloser{
+		Reader: content.NewReader(ra),
+		Closer: ra,
+	}, nil
+}
+
+func (r *ContainerdResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	return nil, errors.Wrap(errdefs.ErrNotImplemented, "pushing to containerd is not supported")
+}
+
+type readerAtCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/docker/go-imageinspect/testutil"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type imageStore map[string]images.Image
+
+func (s imageStore) Get(ctx context.Context, name string) (images.Image, error) {
+	img, ok := s[name]
+	if !ok {
+		return images.Image{}, errors.Wrapf(errdefs.ErrNotFound, "image %q", name)
+	}
+	return img, nil
+}
+
+func (s imageStore) List(ctx context.Context, filters ...string) ([]images.Image, error) {
+	return nil, errdefs.ErrNotImplemented
+}
+
+func (s imageStore) Create(ctx context.Context, image images.Image) (images.Image, error) {
+	return images.Image{}, errdefs.ErrNotImplemented
+}
+
+func (s imageStore) Update(ctx context.Context, image images.Image, fieldpaths ...string) (images.Image, error) {
+	return images.Image{}, errdefs.ErrNotImplemented
+}
+
+func (s imageStore) Delete(ctx context.Context, name string, opts ...images.DeleteOpt) error {
+	return errdefs.ErrNotImplemented
+}
+
+func TestContainerd(t *testing.T) {
+	t.Parallel()
+
+	ctx := namespaces.WithNamespace(context.Background(), "test")
+
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Architecture: "arm64",
+		OS:           "linux",
+	})
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Annotations: map[string]string{
+			"org.opencontainers.image.title": "this is title",
+		},
+	})
+	require.NoError(t, err)
+
+	stmt, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+		"builder": map[string]string{"id": "https://example.com/builder"},
+	})
+	require.NoError(t, err)
+
+	att, err := testutil.AttestationManifest(mfst.Descriptor, stmt.Descriptor)
+	require.NoError(t, err)
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			mfst.Descriptor,
+			att.Descriptor,
+		},
+	})
+	require.NoError(t, err)
+
+	for _, b := range []*testutil.Blob{cfg, mfst, stmt, att, idx} {
+		require.NoError(t, content.WriteBlob(ctx, cs, b.Descriptor.Digest.String(), bytes.NewReader(b.Data), b.Descriptor))
+	}
+
+	resolver := NewContainerdResolver(cs, imageStore{
+		"docker.io/library/test:latest": images.Image{
+			Name:   "docker.io/library/test:latest",
+			Target: idx.Descriptor,
+		},
+	})
+
+	l, err := NewLoader(Opt{
+		Resolver: resolver,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	require.Equal(t, idx.Descriptor.Digest, r.Digest)
+	require.Equal(t, []string{"linux/arm64"}, r.Platforms)
+
+	img, ok := r.Images["linux/arm64"]
+	require.True(t, ok)
+	require.Equal(t, "this is title", img.Title)
+	require.NotNil(t, img.Provenance)
+	require.Equal(t, "https://example.com/builder", img.Provenance.BuilderID)
+
+	require.NoError(t, cs.Delete(ctx, stmt.Descriptor.Digest))
+
+	l, err = NewLoader(Opt{
+		Resolver: resolver,
+	})
+	require.NoError(t, err)
+
+	_, err = l.Load(ctx, "test")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to fetch attestation "+stmt.Descriptor.Digest.String())
+	require.Contains(t, err.Error(), "garbage collected")
+}
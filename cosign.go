@@ -0,0 +1,253 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+
+	"github.com/containerd/containerd/errdefs"
+	distref "github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	MediaTypeCosignSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	AnnotationCosignSignature     = "dev.cosignproject.cosign/signature"
+	AnnotationCosignCertificate   = "dev.sigstore.cosign/certificate"
+	AnnotationCosignChain         = "dev.sigstore.cosign/chain"
+	AnnotationCosignBundle        = "dev.sigstore.cosign/bundle"
+	AnnotationCosignPredicateType = "predicateType"
+)
+
+// cosignArtifacts are the manifests stored under the cosign tags of a
+// subject.
+type cosignArtifacts struct {
+	signatures   *ocispec.Manifest
+	attestations *ocispec.Manifest
+}
+
+// simpleSigningPayload is the payload signed by cosign, as defined in
+// https://github.com/containers/image/blob/main/docs/containers-signature.5.md
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest digest.Digest `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional,omitempty"`
+}
+
+// fetchCosign resolves the "sha256-<hex>.sig" and "sha256-<hex>.att" tags of
+// each subject.
+func (l *Loader) fetchCosign(ctx context.Context, named distref.Named, r *result, subjects []digest.Digest) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, subject := range subjects {
+		subject := subject
+		eg.Go(func() error {
+			var sig, att *ocispec.Manifest
+			var err error
+			if l.want(PartSignatures) {
+				sig, err = l.cosignManifest(ctx, named, subject, "sig")
+				if err := r.recordSubjectError(l, ComponentSignature, subject, err); err != nil {
+					return err
+				}
+			}
+			if l.want(PartSBOM | PartProvenance) {
+				att, err = l.cosignManifest(ctx, named, subject, "att")
+				if err := r.recordSubjectError(l, ComponentAttestation, subject, err); err != nil {
+					return err
+				}
+			}
+			r.mu.Lock()
+			r.cosign[subject] = cosignArtifacts{
+				signatures:   sig,
+				attestations: att,
+			}
+			r.mu.Unlock()
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+func (l *Loader) cosignManifest(ctx context.Context, named distref.Named, subject digest.Digest, suffix string) (*ocispec.Manifest, error) {
+	tagged, err := distref.WithTag(distref.TrimNamed(named), subject.Algorithm().String()+"-"+subject.Hex()+"."+suffix)
+	if err != nil {
+		return nil, err
+	}
+	_, desc, err := l.opt.Resolver.Resolve(ctx, tagged.String())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	fetcher, err := l.opt.Resolver.Fetcher(ctx, tagged.String())
+	if err != nil {
+		return nil, err
+	}
+	dt, err := l.readBlob(ctx, fetcher, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", tagged)
+	}
+	var mfst ocispec.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", tagged)
+	}
+	return &mfst, nil
+}
+
+// scanCosign adds the cosign signatures and attestations of the subjects to
+// img.
+func (l *Loader) scanCosign(ctx context.Context, fetcher remotes.Fetcher, r *result, subjects []digest.Digest, img *Image) error {
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeCosignSimpleSigning, "cosign")
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeDSSE, "dsse")
+
+	for _, subject := range subjects {
+		a := r.cosign[subject]
+
+		if a.signatures != nil {
+			for _, layer := range a.signatures.Layers {
+				if layer.MediaType != MediaTypeCosignSimpleSigning {
+					continue
+				}
+				sig, err := l.readCosignSignature(ctx, fetcher, layer, subject)
+				if err != nil {
+					if err := l.recordError(&img.Errors, ComponentSignature, layer.Digest, err); err != nil {
+						return err
+					}
+					continue
+				}
+				img.Signatures = append(img.Signatures, *sig)
+			}
+		}
+
+		if a.attestations != nil {
+			for _, layer := range a.attestations.Layers {
+				if layer.MediaType != MediaTypeDSSE {
+					continue
+				}
+				if pt, ok := layer.Annotations[AnnotationCosignPredicateType]; ok && !l.wantPredicate(pt) {
+					continue
+				}
+				if err := l.recordError(&img.Errors, ComponentAttestation, layer.Digest, l.scanCosignAttestation(ctx, fetcher, layer, subject, img)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	normalizeSBOM(img.SBOM)
+
+	return nil
+}
+
+func (l *Loader) readCosignSignature(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor, subject digest.Digest) (*Signature, error) {
+	dt, err := l.readBlob(ctx, fetcher, layer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch signature %s", layer.Digest)
+	}
+
+	var payload simpleSigningPayload
+	if err := json.Unmarshal(dt, &payload); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode signature payload %s", layer.Digest)
+	}
+	if payload.Critical.Image.DockerManifestDigest != subject {
+		return nil, errors.Errorf("signature %s is for %s, expected %s", layer.Digest, payload.Critical.Image.DockerManifestDigest, subject)
+	}
+
+	s := &Signature{
+		Type:    SignatureTypeCosign,
+		Subject: subject,
+	}
+
+	if b64, ok := layer.Annotations[AnnotationCosignSignature]; ok {
+		sig, err := decodeBase64(b64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode signature %s", layer.Digest)
+		}
+		var m *keylessMaterial
+		if l.opt.TrustedRoot != nil {
+			m, err = cosignKeylessMaterial(layer.Annotations)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid signature %s", layer.Digest)
+			}
+		}
+		if key, ok := verifyWithKeys(l.keys, dt, sig); ok {
+			s.Verified = true
+			s.Identity.PublicKey = key.pem
+		} else if m != nil {
+			payloadDigest := sha256.Sum256(dt)
+			id, err := l.opt.TrustedRoot.verify(*m, func(pub crypto.PublicKey) error {
+				return verifySignature(pub, dt, sig)
+			}, func(body []byte) error {
+				return checkRekorBody(body, payloadDigest[:], sig)
+			})
+			if err == nil {
+				s.Verified = true
+				s.Identity = *id
+			} else {
+				s.Error = err.Error()
+			}
+		} else if len(l.keys) > 0 {
+			s.Error = errNoMatchingKey
+		}
+	}
+
+	return s, nil
+}
+
+func (l *Loader) scanCosignAttestation(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor, subject digest.Digest, img *Image) error {
+	dt, err := l.readBlob(ctx, fetcher, layer)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch attestation %s", layer.Digest)
+	}
+
+	env, payload, err := decodeDSSE(dt)
+	if err != nil {
+		return err
+	}
+	if env.PayloadType != MediaTypeInToto {
+		return nil
+	}
+
+	stmt, err := decodeStatement(payload, subject)
+	if err != nil {
+		return err
+	}
+
+	// keyless attestations carry the certificate and transparency log
+	// bundle in the same annotations as signatures
+	var m *keylessMaterial
+	if l.opt.TrustedRoot != nil {
+		m, err = cosignKeylessMaterial(layer.Annotations)
+		if err != nil {
+			return errors.Wrapf(err, "invalid attestation %s", layer.Digest)
+		}
+	}
+	return l.addStatement(img, stmt, l.verifyDSSE(env, payload, subject, m))
+}
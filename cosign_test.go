@@ -0,0 +1,253 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/docker/go-imageinspect/testutil"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// cosignImage adds a single platform image with a cosign signature tag to env
+// and returns its manifest. The signature payload is signed with sign.
+func cosignImage(t *testing.T, env *testutil.Env, sign func([]byte) []byte, annotate ...func(map[string]string)) *testutil.Blob {
+	cfg, err := testutil.Config(ocispec.Image{})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", mfst.Descriptor.Digest))
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"critical": map[string]interface{}{
+			"identity": map[string]string{"docker-reference": "docker.io/library/test"},
+			"image":    map[string]string{"docker-manifest-digest": mfst.Descriptor.Digest.String()},
+			"type":     "cosign container image signature",
+		},
+	})
+	require.NoError(t, err)
+	annotations := map[string]string{
+		"dev.cosignproject.cosign/signature": base64.StdEncoding.EncodeToString(sign(payload)),
+	}
+	for _, f := range annotate {
+		f(annotations)
+	}
+	sigPayload := &testutil.Blob{
+		Data: payload,
+		Descriptor: ocispec.Descriptor{
+			MediaType:   "application/vnd.dev.cosign.simplesigning.v1+json",
+			Digest:      digest.FromBytes(payload),
+			Size:        int64(len(payload)),
+			Annotations: annotations,
+		},
+	}
+	_, err = env.AddBlob(sigPayload)
+	require.NoError(t, err)
+
+	sig, err := testutil.Manifest(ocispec.Manifest{
+		Config: ocispec.Descriptor{
+			Digest: digest.FromString("{}"),
+			Size:   2,
+		},
+		Layers: []ocispec.Descriptor{sigPayload.Descriptor},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(sig)
+	require.NoError(t, err)
+	require.NoError(t, env.AddTag("docker.io/library/test:sha256-"+mfst.Descriptor.Digest.Hex()+".sig", sig.Descriptor.Digest))
+
+	return mfst
+}
+
+func TestCosign(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	mfst := cosignImage(t, env, func([]byte) []byte {
+		return []byte("signature")
+	})
+
+	stmt, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+		"builder": map[string]string{"id": "https://example.com/builder"},
+	})
+	require.NoError(t, err)
+	envelope, err := json.Marshal(map[string]interface{}{
+		"payloadType": "application/vnd.in-toto+json",
+		"payload":     base64.StdEncoding.EncodeToString(stmt.Data),
+		"signatures":  []interface{}{},
+	})
+	require.NoError(t, err)
+	attLayer := &testutil.Blob{
+		Data: envelope,
+		Descriptor: ocispec.Descriptor{
+			MediaType: "application/vnd.dsse.envelope.v1+json",
+			Digest:    digest.FromBytes(envelope),
+			Size:      int64(len(envelope)),
+			Annotations: map[string]string{
+				"predicateType": "https://slsa.dev/provenance/v0.2",
+			},
+		},
+	}
+	_, err = env.AddBlob(attLayer)
+	require.NoError(t, err)
+
+	att, err := testutil.Manifest(ocispec.Manifest{
+		Config: ocispec.Descriptor{
+			Digest: digest.FromString("{}"),
+			Size:   2,
+		},
+		Layers: []ocispec.Descriptor{attLayer.Descriptor},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(att)
+	require.NoError(t, err)
+	require.NoError(t, env.AddTag("docker.io/library/test:sha256-"+mfst.Descriptor.Digest.Hex()+".att", att.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img := r.Images["linux/amd64"]
+	require.Nil(t, img.Provenance)
+	require.Empty(t, img.Signatures)
+
+	l, err = NewLoader(Opt{
+		Resolver: env,
+		Cosign:   true,
+	})
+	require.NoError(t, err)
+
+	r, err = l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img = r.Images["linux/amd64"]
+	require.NotNil(t, img.Provenance)
+	require.Equal(t, "https://example.com/builder", img.Provenance.BuilderID)
+
+	require.Equal(t, []Signature{
+		{
+			Type:    SignatureTypeCosign,
+			Subject: mfst.Descriptor.Digest,
+		},
+	}, img.Signatures)
+}
+
+func TestCosignVerify(t *testing.T) {
+	t.Parallel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var pems []byte
+	for _, pub := range []crypto.PublicKey{&ecKey.PublicKey, &rsaKey.PublicKey, edPub} {
+		dt, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(t, err)
+		pems = append(pems, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: dt})...)
+	}
+	keys, err := ParsePublicKeys(pems)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(keys))
+
+	for _, tc := range []struct {
+		name     string
+		signer   crypto.Signer
+		verified bool
+	}{
+		{name: "ecdsa", signer: ecKey, verified: true},
+		{name: "rsa", signer: rsaKey, verified: true},
+		{name: "ed25519", signer: edKey, verified: true},
+		{name: "unknown", signer: otherKey, verified: false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			env := testutil.NewEnv(t)
+
+			mfst := cosignImage(t, env, func(payload []byte) []byte {
+				var sig []byte
+				var err error
+				if _, ok := tc.signer.(ed25519.PrivateKey); ok {
+					sig, err = tc.signer.Sign(rand.Reader, payload, crypto.Hash(0))
+				} else {
+					h := sha256.Sum256(payload)
+					sig, err = tc.signer.Sign(rand.Reader, h[:], crypto.SHA256)
+				}
+				require.NoError(t, err)
+				return sig
+			})
+
+			l, err := NewLoader(Opt{
+				Resolver:   env,
+				Cosign:     true,
+				PublicKeys: keys,
+			})
+			require.NoError(t, err)
+
+			r, err := l.Load(ctx, "test")
+			require.NoError(t, err)
+
+			img := r.Images["linux/amd64"]
+			require.Equal(t, 1, len(img.Signatures))
+
+			sig := img.Signatures[0]
+			require.Equal(t, mfst.Descriptor.Digest, sig.Subject)
+			require.Equal(t, tc.verified, sig.Verified)
+			if !tc.verified {
+				require.Empty(t, sig.Identity.PublicKey)
+				return
+			}
+			dt, err := x509.MarshalPKIXPublicKey(tc.signer.Public())
+			require.NoError(t, err)
+			require.Equal(t, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: dt})), sig.Identity.PublicKey)
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+const (
+	MediaTypeCycloneDX = "application/vnd.cyclonedx+json"
+	PredicateCycloneDX = "https://cyclonedx.org/bom"
+)
+
+// cdxBOM is the subset of a CycloneDX 1.4 or 1.5 JSON document mapped to
+// the SBOM.
+type cdxBOM struct {
+	BOMFormat    string `json:"bomFormat"`
+	SpecVersion  string `json:"specVersion"`
+	SerialNumber string `json:"serialNumber"`
+	Metadata     struct {
+		Component *cdxComponent `json:"component"`
+	} `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+
+	// digest is the digest of the encoded document.
+	digest digest.Digest
+}
+
+type cdxComponent struct {
+	BOMRef      string `json:"bom-ref"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Author      string `json:"author"`
+	Publisher   string `json:"publisher"`
+	Supplier    *struct {
+		Name string `json:"name"`
+	} `json:"supplier"`
+	Licenses []struct {
+		License *struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"license"`
+		Expression string `json:"expression"`
+	} `json:"licenses"`
+	Hashes []struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	} `json:"hashes"`
+	PURL               string `json:"purl"`
+	CPE                string `json:"cpe"`
+	ExternalReferences []struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	} `json:"externalReferences"`
+	Properties []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"properties"`
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func decodeCycloneDX(dt []byte) (*cdxBOM, error) {
+	var bom cdxBOM
+	if err := json.Unmarshal(dt, &bom); err != nil {
+		return nil, errors.Wrap(err, "unable to decode cyclonedx")
+	}
+	if bom.BOMFormat != "CycloneDX" {
+		return nil, errors.Errorf("unable to decode cyclonedx: invalid bom format %q", bom.BOMFormat)
+	}
+	if !strings.HasPrefix(bom.SpecVersion, "1.") {
+		return nil, errors.Errorf("unable to decode cyclonedx: unsupported spec version %q", bom.SpecVersion)
+	}
+	bom.digest = digest.FromBytes(dt)
+	return &bom, nil
+}
+
+func addCycloneDX(img *Image, bom *cdxBOM, sigs []Signature) {
+	sbom := img.SBOM
+	if sbom == nil {
+		sbom = &SBOM{}
+	}
+
+	source := SBOMDocument{
+		ID:         bom.SerialNumber,
+		Format:     SBOMFormatCycloneDX,
+		Signatures: sigs,
+	}
+	if source.ID == "" {
+		source.ID = bom.digest.String()
+	}
+	if bom.Metadata.Component != nil {
+		source.Name = bom.Metadata.Component.Name
+	}
+	sbom.addDocument(source)
+
+	var pkgs []Package
+	var refs []string
+	ids := map[string]string{}
+
+	var add func(components []cdxComponent)
+	add = func(components []cdxComponent) {
+		for _, c := range components {
+			add(c.Components)
+			// files are listed as components but aren't packages
+			if c.Type == "file" {
+				continue
+			}
+			pkg := cycloneDXPackage(c)
+			pkg.Sources = []string{source.ID}
+			if c.BOMRef != "" {
+				ids[c.BOMRef] = pkg.ID
+			}
+			pkgs = append(pkgs, pkg)
+			refs = append(refs, c.BOMRef)
+		}
+	}
+	add(bom.Components)
+
+	// the dependencies of the described component are the top-level
+	// packages of the document
+	var root string
+	if bom.Metadata.Component != nil {
+		root = bom.Metadata.Component.BOMRef
+	}
+
+	deps := map[string][]string{}
+	for _, d := range bom.Dependencies {
+		for _, ref := range d.DependsOn {
+			id, ok := ids[ref]
+			if !ok {
+				continue
+			}
+			if root != "" && d.Ref == root {
+				sbom.Relationships = append(sbom.Relationships, Relationship{From: source.ID, Type: RelationshipDescribes, To: id})
+				continue
+			}
+			from, ok := ids[d.Ref]
+			if !ok {
+				continue
+			}
+			sbom.Relationships = append(sbom.Relationships, Relationship{From: from, Type: RelationshipDependsOn, To: id})
+			deps[d.Ref] = append(deps[d.Ref], id)
+		}
+	}
+	for i, ref := range refs {
+		if ref != "" {
+			pkgs[i].Dependencies = deps[ref]
+		}
+	}
+
+	for _, pkg := range pkgs {
+		sbom.addPackage(pkg)
+	}
+	img.SBOM = sbom
+}
+
+func cycloneDXPackage(c cdxComponent) Package {
+	pkg := Package{
+		Name:        c.Name,
+		Version:     c.Version,
+		Description: c.Description,
+	}
+
+	pkg.Creator.Name = c.Author
+	pkg.Creator.Org = c.Publisher
+	if c.Supplier != nil && c.Supplier.Name != "" {
+		pkg.Creator.Org = c.Supplier.Name
+	}
+
+	for _, ref := range c.ExternalReferences {
+		switch ref.Type {
+		case "website":
+			pkg.HomepageURL = ref.URL
+		case "distribution":
+			pkg.DownloadURL = ref.URL
+		}
+	}
+
+	for _, l := range c.Licenses {
+		switch {
+		case l.Expression != "":
+			pkg.License = append(pkg.License, strings.Split(l.Expression, " AND ")...)
+		case l.License != nil && l.License.ID != "":
+			pkg.License = append(pkg.License, l.License.ID)
+		case l.License != nil && l.License.Name != "":
+			pkg.License = append(pkg.License, l.License.Name)
+		}
+	}
+
+	if c.PURL != "" {
+		if purl, err := ParsePackageURL(c.PURL); err == nil {
+			pkg.PURL = purl
+		}
+	}
+
+	if c.CPE != "" {
+		pkg.CPEs = append(pkg.CPEs, c.CPE)
+	}
+	// syft records the CPEs that don't fit in the cpe field as properties
+	for _, p := range c.Properties {
+		if p.Name == "syft:cpe23" {
+			pkg.CPEs = append(pkg.CPEs, p.Value)
+		}
+	}
+
+	for _, h := range c.Hashes {
+		if pkg.Hashes == nil {
+			pkg.Hashes = make(map[string]string)
+		}
+		pkg.Hashes[hashAlgorithm(h.Alg)] = h.Content
+	}
+
+	pkg.setID()
+	return pkg
+}
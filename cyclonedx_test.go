@@ -0,0 +1,167 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/go-imageinspect/testutil"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+const testCycloneDX = `{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "version": 1,
+  "metadata": {
+    "component": {"bom-ref": "image", "type": "container", "name": "test"}
+  },
+  "components": [
+    {
+      "bom-ref": "pkg:deb/debian/curl@7.74.0-1.3?arch=amd64",
+      "type": "library",
+      "name": "curl",
+      "version": "7.74.0-1.3",
+      "publisher": "Debian",
+      "licenses": [{"license": {"id": "curl"}}],
+      "hashes": [{"alg": "SHA-256", "content": "8c6b3b4c"}],
+      "purl": "pkg:deb/debian/curl@7.74.0-1.3?arch=amd64",
+      "cpe": "cpe:2.3:a:haxx:curl:7.74.0:*:*:*:*:*:*:*",
+      "properties": [
+        {"name": "syft:cpe23", "value": "cpe:2.3:a:curl:curl:7.74.0:*:*:*:*:*:*:*"}
+      ],
+      "externalReferences": [
+        {"type": "website", "url": "https://curl.se"}
+      ]
+    },
+    {
+      "bom-ref": "libcurl",
+      "type": "library",
+      "name": "libcurl4",
+      "version": "7.74.0-1.3",
+      "licenses": [{"expression": "curl AND MIT"}],
+      "purl": "pkg:deb/debian/libcurl4@7.74.0-1.3?arch=amd64",
+      "components": [
+        {"bom-ref": "lib", "type": "file", "name": "/usr/lib/libcurl.so.4"}
+      ]
+    },
+    {
+      "bom-ref": "app",
+      "type": "application",
+      "name": "app",
+      "version": "1.0.0"
+    }
+  ],
+  "dependencies": [
+    {"ref": "image", "dependsOn": ["app"]},
+    {"ref": "pkg:deb/debian/curl@7.74.0-1.3?arch=amd64", "dependsOn": ["libcurl", "lib", "missing"]},
+    {"ref": "libcurl", "dependsOn": []}
+  ]
+}`
+
+func TestCycloneDX(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	cfg, err := testutil.Config(ocispec.Image{})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	stmt, err := testutil.Statement(mfst.Descriptor, PredicateCycloneDX, json.RawMessage(testCycloneDX))
+	require.NoError(t, err)
+	_, err = env.AddBlob(stmt)
+	require.NoError(t, err)
+
+	att, err := testutil.AttestationManifest(mfst.Descriptor, stmt.Descriptor)
+	require.NoError(t, err)
+	_, err = env.AddBlob(att)
+	require.NoError(t, err)
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			mfst.Descriptor,
+			att.Descriptor,
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	sbom := r.Images["linux/amd64"].SBOM
+	require.NotNil(t, sbom)
+
+	require.Len(t, sbom.DebianPackages, 2)
+	curl := sbom.DebianPackages[0]
+	require.Equal(t, "pkg:deb/debian/curl@7.74.0-1.3?arch=amd64", curl.ID)
+	require.Equal(t, "curl", curl.Name)
+	require.Equal(t, "7.74.0-1.3", curl.Version)
+	require.Equal(t, PackageCreator{Org: "Debian"}, curl.Creator)
+	require.Equal(t, []string{"curl"}, curl.License)
+	require.Equal(t, map[string]string{"sha256": "8c6b3b4c"}, curl.Hashes)
+	require.Equal(t, "https://curl.se", curl.HomepageURL)
+	require.Equal(t, []string{
+		"cpe:2.3:a:haxx:curl:7.74.0:*:*:*:*:*:*:*",
+		"cpe:2.3:a:curl:curl:7.74.0:*:*:*:*:*:*:*",
+	}, curl.CPEs)
+	require.Equal(t, []string{"pkg:deb/debian/libcurl4@7.74.0-1.3?arch=amd64"}, curl.Dependencies)
+
+	libcurl := sbom.DebianPackages[1]
+	require.Equal(t, "libcurl4", libcurl.Name)
+	require.Equal(t, []string{"curl", "MIT"}, libcurl.License)
+	require.Empty(t, libcurl.Dependencies)
+
+	require.Len(t, sbom.UnknownPackages, 1)
+	require.Equal(t, "app@1.0.0", sbom.UnknownPackages[0].ID)
+
+	require.Len(t, sbom.Documents, 1)
+	require.Equal(t, []Relationship{
+		{From: sbom.Documents[0].ID, Type: RelationshipDescribes, To: "app@1.0.0"},
+		{From: curl.ID, Type: RelationshipDependsOn, To: libcurl.ID},
+	}, sbom.Relationships)
+	require.Equal(t, []string{curl.ID}, packageIDs(sbom.Dependents(libcurl.ID)))
+}
+
+func TestCycloneDXInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := decodeCycloneDX([]byte(`{"bomFormat": "SPDX", "specVersion": "1.4"}`))
+	require.Error(t, err)
+
+	_, err = decodeCycloneDX([]byte(`{"bomFormat": "CycloneDX", "specVersion": "2.0"}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+const MediaTypeDSSE = "application/vnd.dsse.envelope.v1+json"
+
+// dsseEnvelope is a DSSE envelope as defined in
+// https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+func decodeDSSE(dt []byte) (*dsseEnvelope, []byte, error) {
+	var env dsseEnvelope
+	if err := json.Unmarshal(dt, &env); err != nil {
+		return nil, nil, errors.Wrap(err, "unable to decode dsse envelope")
+	}
+	payload, err := decodeBase64(env.Payload)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to decode dsse payload")
+	}
+	return &env, payload, nil
+}
+
+// decodeBase64 decodes standard or URL-safe base64, with or without padding,
+// as both are accepted by DSSE implementations.
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if dt, err := enc.DecodeString(s); err == nil {
+			return dt, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
+
+// pae returns the DSSE pre-authentication encoding of the payload, which is
+// the message covered by envelope signatures.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// verifyDSSE returns the signatures of env over payload. Signatures are
+// verified against the configured public keys, or against the trusted root
+// with the keyless material m if it isn't nil.
+func (l *Loader) verifyDSSE(env *dsseEnvelope, payload []byte, subject digest.Digest, m *keylessMaterial) []Signature {
+	msg := pae(env.PayloadType, payload)
+	payloadDigest := sha256.Sum256(payload)
+
+	var sigs []Signature
+	for _, es := range env.Signatures {
+		s := Signature{
+			Type:    SignatureTypeDSSE,
+			Subject: subject,
+			Identity: Identity{
+				KeyID: es.KeyID,
+			},
+		}
+		if sig, err := decodeBase64(es.Sig); err != nil {
+			s.Error = "invalid signature encoding"
+		} else if key, ok := verifyWithKeys(l.keys, msg, sig); ok {
+			s.Verified = true
+			s.Identity.PublicKey = key.pem
+		} else if m != nil {
+			id, err := l.opt.TrustedRoot.verify(*m, func(pub crypto.PublicKey) error {
+				return verifySignature(pub, msg, sig)
+			}, func(body []byte) error {
+				return checkRekorBody(body, payloadDigest[:], sig)
+			})
+			if err == nil {
+				s.Verified = true
+				s.Identity = *id
+				s.Identity.KeyID = es.KeyID
+			} else {
+				s.Error = err.Error()
+			}
+		} else if len(l.keys) > 0 {
+			s.Error = errNoMatchingKey
+		}
+		sigs = append(sigs, s)
+	}
+	return sigs
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/docker/go-imageinspect/testutil"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDSSEAttestation(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	dt, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: dt}))
+
+	sign := func(k *ecdsa.PrivateKey) func([]byte) []byte {
+		return func(dt []byte) []byte {
+			h := sha256.Sum256(dt)
+			sig, err := k.Sign(rand.Reader, h[:], crypto.SHA256)
+			require.NoError(t, err)
+			return sig
+		}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		sign       func([]byte) []byte
+		signatures []Signature
+	}{
+		{
+			name:       "unsigned",
+			signatures: nil,
+		},
+		{
+			name: "verified",
+			sign: sign(key),
+			signatures: []Signature{
+				{
+					Type:     SignatureTypeDSSE,
+					Verified: true,
+					Identity: Identity{PublicKey: keyPEM, KeyID: "test"},
+				},
+			},
+		},
+		{
+			name: "unknown key",
+			sign: sign(otherKey),
+			signatures: []Signature{
+				{
+					Type:     SignatureTypeDSSE,
+					Error:    errNoMatchingKey,
+					Identity: Identity{KeyID: "test"},
+				},
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			env := testutil.NewEnv(t)
+
+			cfg, err := testutil.Config(ocispec.Image{})
+			require.NoError(t, err)
+			_, err = env.AddBlob(cfg)
+			require.NoError(t, err)
+
+			mfst, err := testutil.Manifest(ocispec.Manifest{
+				Config: cfg.Descriptor,
+			})
+			require.NoError(t, err)
+			_, err = env.AddBlob(mfst)
+			require.NoError(t, err)
+
+			stmt, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+				"builder": map[string]string{"id": "https://github.com/docker/go-imageinspect/actions/runs/1"},
+			})
+			require.NoError(t, err)
+			envelope, err := testutil.Envelope(stmt, "test", tc.sign)
+			require.NoError(t, err)
+			_, err = env.AddBlob(envelope)
+			require.NoError(t, err)
+
+			att, err := testutil.AttestationManifest(mfst.Descriptor, envelope.Descriptor)
+			require.NoError(t, err)
+			_, err = env.AddBlob(att)
+			require.NoError(t, err)
+
+			idx, err := testutil.Index(ocispec.Index{
+				Manifests: []ocispec.Descriptor{
+					mfst.Descriptor,
+					att.Descriptor,
+				},
+			})
+			require.NoError(t, err)
+			_, err = env.AddBlob(idx)
+			require.NoError(t, err)
+
+			require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+			l, err := NewLoader(Opt{
+				Resolver:   env,
+				PublicKeys: []crypto.PublicKey{&key.PublicKey},
+			})
+			require.NoError(t, err)
+
+			r, err := l.Load(ctx, "test")
+			require.NoError(t, err)
+
+			img := r.Images["linux/amd64"]
+			require.NotNil(t, img.Provenance)
+			require.Equal(t, "https://github.com/docker/go-imageinspect/actions/runs/1", img.Provenance.BuilderID)
+
+			for i := range tc.signatures {
+				tc.signatures[i].Subject = mfst.Descriptor.Digest
+			}
+			require.Equal(t, tc.signatures, img.Provenance.Signatures)
+		})
+	}
+}
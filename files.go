@@ -0,0 +1,162 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// File is an entry of a layer archive or of the image filesystem.
+type File struct {
+	// Path is the absolute path of the file.
+	Path     string
+	Mode     os.FileMode
+	Size     int64
+	UID      int
+	GID      int
+	Linkname string `json:",omitempty"`
+	// Whiteout is set for the entries of a layer that delete Path from the
+	// layers below.
+	Whiteout bool `json:",omitempty"`
+	// Opaque is set for the whiteouts that only delete the content of the
+	// Path directory.
+	Opaque bool `json:",omitempty"`
+	// Layer is the digest of the layer that last added or modified the
+	// file, only set for the image filesystem.
+	Layer digest.Digest `json:",omitempty"`
+}
+
+// walkFiles calls fn for each entry of a layer archive, along with a reader
+// for its content.
+func walkFiles(r io.Reader, fn func(File, io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var f File
+
+		p := cleanPath(hdr.Name)
+		dir, base := path.Split(p)
+		switch {
+		case base == whiteoutOpaque:
+			f = File{Path: path.Clean(dir), Whiteout: true, Opaque: true}
+		case strings.HasPrefix(base, whiteoutPrefix):
+			f = File{Path: dir + strings.TrimPrefix(base, whiteoutPrefix), Whiteout: true}
+		default:
+			f = File{
+				Path:     p,
+				Mode:     hdr.FileInfo().Mode(),
+				Size:     hdr.Size,
+				UID:      hdr.Uid,
+				GID:      hdr.Gid,
+				Linkname: hdr.Linkname,
+			}
+			if hdr.Typeflag == tar.TypeLink {
+				f.Linkname = cleanPath(hdr.Linkname)
+			}
+		}
+
+		if err := fn(f, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// mergeFiles applies the files of layers on top of each other and returns
+// the files of the resulting filesystem, sorted by path.
+func mergeFiles(layers []Layer) []File {
+	fs := make(map[string]File)
+
+	for _, layer := range layers {
+		// whiteouts only apply to the layers below, so they are applied
+		// before the files of the layer are added
+		deleted := make(map[string]struct{})
+		opaque := make(map[string]struct{})
+		for _, f := range layer.Files {
+			if !f.Whiteout {
+				continue
+			}
+			if f.Opaque {
+				opaque[f.Path] = struct{}{}
+			} else {
+				deleted[f.Path] = struct{}{}
+			}
+		}
+		if len(deleted) > 0 || len(opaque) > 0 {
+			for p := range fs {
+				if isWhiteout(p, deleted, opaque) {
+					delete(fs, p)
+				}
+			}
+		}
+
+		for _, f := range layer.Files {
+			if f.Whiteout {
+				continue
+			}
+			f.Layer = layer.Digest
+			fs[f.Path] = f
+		}
+	}
+
+	files := make([]File, 0, len(fs))
+	for _, f := range fs {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// isWhiteout reports whether p is deleted by the whiteouts of a layer, either
+// directly or through one of its parent directories.
+func isWhiteout(p string, deleted, opaque map[string]struct{}) bool {
+	if _, ok := deleted[p]; ok {
+		return true
+	}
+	for p != "/" {
+		p = path.Dir(p)
+		if _, ok := deleted[p]; ok {
+			return true
+		}
+		if _, ok := opaque[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/docker/go-imageinspect/testutil"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// layerEntry is an entry of a test layer, regular files are filled with
+// Data or with Size bytes if Data is empty.
+type layerEntry struct {
+	*tar.Header
+	Data string
+}
+
+func layerBlob(t *testing.T, compress bool, entries ...layerEntry) *testutil.Blob {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		dt := []byte(e.Data)
+		if e.Typeflag == tar.TypeReg && len(dt) == 0 {
+			dt = bytes.Repeat([]byte{'a'}, int(e.Size))
+		}
+		e.Size = int64(len(dt))
+		require.NoError(t, tw.WriteHeader(e.Header))
+		if e.Typeflag == tar.TypeReg {
+			_, err := tw.Write(dt)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+
+	mediaType := ocispec.MediaTypeImageLayer
+	if gz != nil {
+		require.NoError(t, gz.Close())
+		mediaType = ocispec.MediaTypeImageLayerGzip
+	}
+
+	return &testutil.Blob{
+		Data: buf.Bytes(),
+		Descriptor: ocispec.Descriptor{
+			MediaType: mediaType,
+			Digest:    digest.FromBytes(buf.Bytes()),
+			Size:      int64(buf.Len()),
+		},
+	}
+}
+
+func TestFiles(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	dir := func(name string) layerEntry {
+		return layerEntry{Header: &tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0755}}
+	}
+	file := func(name string, size int64) layerEntry {
+		return layerEntry{Header: &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: size, Uid: 1000, Gid: 1000}}
+	}
+
+	base := layerBlob(t, true,
+		dir("./"),
+		dir("./etc/"),
+		file("./etc/passwd", 10),
+		file("./etc/shadow", 5),
+		dir("./opt/"),
+		dir("./opt/app/"),
+		file("./opt/app/old", 3),
+		dir("./usr/"),
+		dir("./usr/bin/"),
+		layerEntry{Header: &tar.Header{Typeflag: tar.TypeSymlink, Name: "./usr/bin/sh", Linkname: "busybox", Mode: 0777}},
+		layerEntry{Header: &tar.Header{Typeflag: tar.TypeLink, Name: "./usr/bin/ls", Linkname: "./usr/bin/busybox"}},
+	)
+	top := layerBlob(t, false,
+		file("etc/.wh.shadow", 0),
+		file("opt/app/.wh..wh..opq", 0),
+		file("opt/app/new", 4),
+		file("usr/bin/curl", 20),
+	)
+
+	for _, b := range []*testutil.Blob{base, top} {
+		_, err := env.AddBlob(b)
+		require.NoError(t, err)
+	}
+
+	cfg, err := testutil.Config(ocispec.Image{})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: []ocispec.Descriptor{base.Descriptor, top.Descriptor},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", mfst.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver:         env,
+		Files:            true,
+		UncompressedSize: true,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img := r.Images["linux/amd64"]
+	require.Len(t, img.Layers, 2)
+	require.Len(t, img.Layers[0].Files, 11)
+	require.Equal(t, int64(len(top.Data)), img.Layers[1].UncompressedSize)
+
+	require.Equal(t, []File{
+		{Path: "/etc/shadow", Whiteout: true},
+		{Path: "/opt/app", Whiteout: true, Opaque: true},
+		{Path: "/opt/app/new", Mode: 0644, Size: 4, UID: 1000, GID: 1000},
+		{Path: "/usr/bin/curl", Mode: 0644, Size: 20, UID: 1000, GID: 1000},
+	}, img.Layers[1].Files)
+
+	paths := make(map[string]File)
+	for _, f := range img.Files {
+		paths[f.Path] = f
+	}
+
+	require.Equal(t, []string{
+		"/", "/etc", "/etc/passwd", "/opt", "/opt/app", "/opt/app/new",
+		"/usr", "/usr/bin", "/usr/bin/curl", "/usr/bin/ls", "/usr/bin/sh",
+	}, filePaths(img.Files))
+
+	require.Equal(t, top.Descriptor.Digest, paths["/usr/bin/curl"].Layer)
+	require.Equal(t, base.Descriptor.Digest, paths["/etc/passwd"].Layer)
+	require.Equal(t, base.Descriptor.Digest, paths["/opt/app"].Layer)
+	require.Equal(t, os.ModeDir|0755, paths["/opt/app"].Mode)
+	require.Equal(t, "busybox", paths["/usr/bin/sh"].Linkname)
+	require.Equal(t, os.ModeSymlink|0777, paths["/usr/bin/sh"].Mode)
+	require.Equal(t, "/usr/bin/busybox", paths["/usr/bin/ls"].Linkname)
+}
+
+func filePaths(files []File) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	return paths
+}
@@ -4,6 +4,7 @@ go 1.18
 
 require (
 	github.com/containerd/containerd v1.6.10
+	github.com/fxamacker/cbor/v2 v2.4.0
 	github.com/in-toto/in-toto-golang v0.3.4-0.20220709202702-fa494aaa0add
 	github.com/moby/buildkit v0.10.1-0.20221121234933-ae9d0f57c7f3
 	github.com/opencontainers/go-digest v1.0.0
@@ -11,7 +12,10 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/spdx/tools-golang v0.4.0
 	github.com/stretchr/testify v1.8.0
+	github.com/veraison/go-cose v1.1.0
+	golang.org/x/crypto v0.2.0
 	golang.org/x/sync v0.1.0
+	sigs.k8s.io/yaml v1.3.0
 )
 
 require (
@@ -27,12 +31,13 @@ require (
 	github.com/secure-systems-lab/go-securesystemslib v0.4.0 // indirect
 	github.com/shibumi/go-pathspec v1.3.0 // indirect
 	github.com/sirupsen/logrus v1.9.0 // indirect
-	golang.org/x/crypto v0.2.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/net v0.2.0 // indirect
 	golang.org/x/sys v0.2.0 // indirect
 	google.golang.org/genproto v0.0.0-20220502173005-c8bf987b8c21 // indirect
 	google.golang.org/grpc v1.50.1 // indirect
 	google.golang.org/protobuf v1.28.1 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
@@ -0,0 +1,204 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import "sort"
+
+// Relationship is a relationship between two packages of the SBOM, or
+// between an SBOM document and the packages it describes.
+type Relationship struct {
+	// From is the ID of a package, or of the document for DESCRIBES
+	// relationships.
+	From string
+	// Type is the SPDX relationship type, such as "DEPENDS_ON". CycloneDX
+	// dependencies are recorded as DEPENDS_ON relationships.
+	Type string
+	// To is the ID of a package.
+	To string
+}
+
+const (
+	RelationshipDescribes = "DESCRIBES"
+	RelationshipDependsOn = "DEPENDS_ON"
+)
+
+// dependencyOf are the relationship types meaning that the first package is
+// a dependency of the second one.
+var dependencyOf = map[string]struct{}{
+	"DEPENDENCY_OF":          {},
+	"BUILD_DEPENDENCY_OF":    {},
+	"DEV_DEPENDENCY_OF":      {},
+	"OPTIONAL_DEPENDENCY_OF": {},
+	"PROVIDED_DEPENDENCY_OF": {},
+	"RUNTIME_DEPENDENCY_OF":  {},
+	"TEST_DEPENDENCY_OF":     {},
+}
+
+// isDependency reports whether r is a dependency relationship, and whether
+// From is the dependency of To rather than the other way around.
+func (r Relationship) isDependency() (ok, reverse bool) {
+	if r.Type == RelationshipDependsOn {
+		return true, false
+	}
+	if _, ok := dependencyOf[r.Type]; ok {
+		return true, true
+	}
+	return false, false
+}
+
+// Package returns the package of the SBOM with the given ID.
+func (s *SBOM) Package(id string) (Package, bool) {
+	for typ := pkgTypeUnknown; typ < numPkgTypes; typ++ {
+		for _, pkg := range *s.packages(typ) {
+			if pkg.ID == id {
+				return pkg, true
+			}
+		}
+	}
+	return Package{}, false
+}
+
+// Dependencies returns the packages the package with the given ID directly
+// depends on.
+func (s *SBOM) Dependencies(id string) []Package {
+	g := s.graph()
+	return g.packages(g.deps[id])
+}
+
+// Dependents returns the packages directly depending on the package with the
+// given ID.
+func (s *SBOM) Dependents(id string) []Package {
+	g := s.graph()
+	return g.packages(g.rdeps[id])
+}
+
+// TransitiveDependencies returns the packages the package with the given ID
+// depends on, directly or through other packages, closest first.
+func (s *SBOM) TransitiveDependencies(id string) []Package {
+	var pkgs []Package
+	s.WalkDependencies(id, func(pkg Package, depth int) error {
+		pkgs = append(pkgs, pkg)
+		return nil
+	})
+	return pkgs
+}
+
+// TransitiveDependents returns the packages depending on the package with the
+// given ID, directly or through other packages, closest first.
+func (s *SBOM) TransitiveDependents(id string) []Package {
+	var pkgs []Package
+	s.WalkDependents(id, func(pkg Package, depth int) error {
+		pkgs = append(pkgs, pkg)
+		return nil
+	})
+	return pkgs
+}
+
+// TopLevelDependents returns the packages that pulled in the package with the
+// given ID: the packages depending on it, directly or not, that no other
+// package depends on.
+func (s *SBOM) TopLevelDependents(id string) []Package {
+	g := s.graph()
+	var pkgs []Package
+	g.walk(g.rdeps, id, func(pkg Package, depth int) error {
+		if len(g.rdeps[pkg.ID]) == 0 {
+			pkgs = append(pkgs, pkg)
+		}
+		return nil
+	})
+	return pkgs
+}
+
+// WalkDependencies calls fn for each package the package with the given ID
+// depends on, directly or not, in breadth-first order with the depth of the
+// package, starting at 1. Each package is visited once. Walking stops at the
+// first error returned by fn.
+func (s *SBOM) WalkDependencies(id string, fn func(pkg Package, depth int) error) error {
+	g := s.graph()
+	return g.walk(g.deps, id, fn)
+}
+
+// WalkDependents is like WalkDependencies, walking the packages depending on
+// the package with the given ID instead.
+func (s *SBOM) WalkDependents(id string, fn func(pkg Package, depth int) error) error {
+	g := s.graph()
+	return g.walk(g.rdeps, id, fn)
+}
+
+type sbomGraph struct {
+	pkgs  map[string]Package
+	deps  map[string][]string
+	rdeps map[string][]string
+}
+
+func (s *SBOM) graph() *sbomGraph {
+	g := &sbomGraph{
+		pkgs:  make(map[string]Package),
+		deps:  make(map[string][]string),
+		rdeps: make(map[string][]string),
+	}
+	for typ := pkgTypeUnknown; typ < numPkgTypes; typ++ {
+		for _, pkg := range *s.packages(typ) {
+			if _, ok := g.pkgs[pkg.ID]; !ok {
+				g.pkgs[pkg.ID] = pkg
+			}
+		}
+	}
+	for id, pkg := range g.pkgs {
+		for _, dep := range pkg.Dependencies {
+			if _, ok := g.pkgs[dep]; !ok {
+				continue
+			}
+			g.deps[id] = append(g.deps[id], dep)
+			g.rdeps[dep] = append(g.rdeps[dep], id)
+		}
+	}
+	// the dependents are collected from a map, so they are sorted to walk
+	// them in a stable order
+	for _, ids := range g.rdeps {
+		sort.Strings(ids)
+	}
+	return g
+}
+
+func (g *sbomGraph) packages(ids []string) []Package {
+	var pkgs []Package
+	for _, id := range ids {
+		pkgs = append(pkgs, g.pkgs[id])
+	}
+	return pkgs
+}
+
+func (g *sbomGraph) walk(edges map[string][]string, id string, fn func(pkg Package, depth int) error) error {
+	visited := map[string]struct{}{id: {}}
+	queue := []string{id}
+	for depth := 1; len(queue) > 0; depth++ {
+		var next []string
+		for _, id := range queue {
+			for _, e := range edges[id] {
+				if _, ok := visited[e]; ok {
+					continue
+				}
+				visited[e] = struct{}{}
+				if err := fn(g.pkgs[e], depth); err != nil {
+					return err
+				}
+				next = append(next, e)
+			}
+		}
+		queue = next
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const testSPDXGraph = `{
+  "spdxVersion": "SPDX-2.3",
+  "dataLicense": "CC0-1.0",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "name": "test",
+  "documentNamespace": "https://example.com/graph",
+  "creationInfo": {
+    "created": "2022-11-22T10:00:00Z",
+    "creators": ["Tool: test"]
+  },
+  "packages": [
+    {"name": "app", "SPDXID": "SPDXRef-app", "versionInfo": "1.0.0", "downloadLocation": "NOASSERTION"},
+    {"name": "tool", "SPDXID": "SPDXRef-tool", "versionInfo": "2.0.0", "downloadLocation": "NOASSERTION"},
+    {"name": "express", "SPDXID": "SPDXRef-express", "versionInfo": "4.18.2", "downloadLocation": "NOASSERTION"},
+    {"name": "body-parser", "SPDXID": "SPDXRef-body-parser", "versionInfo": "1.20.1", "downloadLocation": "NOASSERTION"},
+    {"name": "lodash", "SPDXID": "SPDXRef-lodash", "versionInfo": "4.17.20", "downloadLocation": "NOASSERTION"}
+  ],
+  "files": [
+    {"fileName": "/app/index.js", "SPDXID": "SPDXRef-File-index", "checksums": [{"algorithm": "SHA1", "checksumValue": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}]}
+  ],
+  "relationships": [
+    {"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-app"},
+    {"spdxElementId": "SPDXRef-app", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File-index"},
+    {"spdxElementId": "SPDXRef-app", "relationshipType": "DEPENDS_ON", "relatedSpdxElement": "SPDXRef-express"},
+    {"spdxElementId": "SPDXRef-body-parser", "relationshipType": "DEPENDENCY_OF", "relatedSpdxElement": "SPDXRef-express"},
+    {"spdxElementId": "SPDXRef-express", "relationshipType": "DEPENDS_ON", "relatedSpdxElement": "SPDXRef-lodash"},
+    {"spdxElementId": "SPDXRef-lodash", "relationshipType": "RUNTIME_DEPENDENCY_OF", "relatedSpdxElement": "SPDXRef-body-parser"},
+    {"spdxElementId": "SPDXRef-tool", "relationshipType": "DEPENDS_ON", "relatedSpdxElement": "SPDXRef-lodash"},
+    {"spdxElementId": "SPDXRef-tool", "relationshipType": "GENERATED_FROM", "relatedSpdxElement": "SPDXRef-app"},
+    {"spdxElementId": "SPDXRef-app", "relationshipType": "DEPENDS_ON", "relatedSpdxElement": "NOASSERTION"}
+  ]
+}`
+
+func TestSBOMGraph(t *testing.T) {
+	t.Parallel()
+
+	doc, err := decodeSPDX([]byte(testSPDXGraph))
+	require.NoError(t, err)
+
+	var img Image
+	addSPDX(&img, doc, nil)
+	addSPDX(&img, doc, nil)
+	normalizeSBOM(img.SBOM)
+	sbom := img.SBOM
+
+	require.Equal(t, []Relationship{
+		{From: "https://example.com/graph", Type: "DESCRIBES", To: "app@1.0.0"},
+		{From: "app@1.0.0", Type: "DEPENDS_ON", To: "express@4.18.2"},
+		{From: "body-parser@1.20.1", Type: "DEPENDENCY_OF", To: "express@4.18.2"},
+		{From: "express@4.18.2", Type: "DEPENDS_ON", To: "lodash@4.17.20"},
+		{From: "lodash@4.17.20", Type: "RUNTIME_DEPENDENCY_OF", To: "body-parser@1.20.1"},
+		{From: "tool@2.0.0", Type: "DEPENDS_ON", To: "lodash@4.17.20"},
+		{From: "tool@2.0.0", Type: "GENERATED_FROM", To: "app@1.0.0"},
+	}, sbom.Relationships)
+
+	pkg, ok := sbom.Package("express@4.18.2")
+	require.True(t, ok)
+	require.Equal(t, []string{"body-parser@1.20.1", "lodash@4.17.20"}, pkg.Dependencies)
+
+	_, ok = sbom.Package("missing@1.0.0")
+	require.False(t, ok)
+
+	require.Equal(t, []string{"express@4.18.2"}, packageIDs(sbom.Dependencies("app@1.0.0")))
+	require.Equal(t, []string{
+		"express@4.18.2",
+		"body-parser@1.20.1",
+		"lodash@4.17.20",
+	}, packageIDs(sbom.TransitiveDependencies("app@1.0.0")))
+
+	require.Equal(t, []string{
+		"body-parser@1.20.1",
+		"express@4.18.2",
+		"tool@2.0.0",
+	}, packageIDs(sbom.Dependents("lodash@4.17.20")))
+	require.Equal(t, []string{
+		"body-parser@1.20.1",
+		"express@4.18.2",
+		"tool@2.0.0",
+		"app@1.0.0",
+	}, packageIDs(sbom.TransitiveDependents("lodash@4.17.20")))
+	require.Equal(t, []string{
+		"tool@2.0.0",
+		"app@1.0.0",
+	}, packageIDs(sbom.TopLevelDependents("lodash@4.17.20")))
+
+	var depths []int
+	errStop := errors.New("stop")
+	err = sbom.WalkDependencies("app@1.0.0", func(pkg Package, depth int) error {
+		depths = append(depths, depth)
+		if pkg.Name == "body-parser" {
+			return errStop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, []int{1, 2}, depths)
+}
+
+func packageIDs(pkgs []Package) []string {
+	ids := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		ids[i] = pkg.ID
+	}
+	return ids
+}
@@ -0,0 +1,205 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"io"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// Layer is a layer of the image filesystem.
+type Layer struct {
+	MediaType string
+	Digest    digest.Digest
+	// Size is the compressed size of the layer blob.
+	Size int64
+	// DiffID is the digest of the uncompressed layer from the rootfs of the
+	// image config.
+	DiffID digest.Digest `json:",omitempty"`
+	// UncompressedSize is only computed with Opt.UncompressedSize.
+	UncompressedSize int64             `json:",omitempty"`
+	Annotations      map[string]string `json:",omitempty"`
+	// Files are the entries of the layer archive, only listed with
+	// Opt.Files.
+	Files []File `json:",omitempty"`
+}
+
+func addLayers(img *Image, config *imageConfig, layers []ocispec.Descriptor) {
+	if len(layers) == 0 {
+		return
+	}
+
+	var diffIDs []digest.Digest
+	if config != nil {
+		diffIDs = config.RootFS.DiffIDs
+	}
+
+	img.Layers = make([]Layer, len(layers))
+	for i, desc := range layers {
+		img.Layers[i] = Layer{
+			MediaType:   desc.MediaType,
+			Digest:      desc.Digest,
+			Size:        desc.Size,
+			Annotations: desc.Annotations,
+		}
+		if i < len(diffIDs) {
+			img.Layers[i].DiffID = diffIDs[i]
+		}
+	}
+}
+
+// maxConcurrentLayers is the number of layers of an image scanned at the same
+// time.
+const maxConcurrentLayers = 3
+
+// scanLayers streams the layers of img to compute their uncompressed size and
+// list their files, according to the options. Layers are not stored in the
+// cache.
+func (l *Loader) scanLayers(ctx context.Context, fetcher remotes.Fetcher, img *Image) error {
+	files := make([][]File, len(img.Layers))
+	secrets := make([][]Secret, len(img.Layers))
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(maxConcurrentLayers)
+	for i := range img.Layers {
+		i, layer := i, &img.Layers[i]
+		eg.Go(func() error {
+			var err error
+			files[i], secrets[i], err = l.scanLayer(ctx, fetcher, layer)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read layer %s", layer.Digest)
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	if l.opt.UncompressedSize {
+		img.UncompressedSize = 0
+		for _, layer := range img.Layers {
+			img.UncompressedSize += layer.UncompressedSize
+		}
+	}
+
+	if !l.opt.Files && !l.opt.Secrets {
+		return nil
+	}
+
+	layers := make([]Layer, len(img.Layers))
+	for i := range img.Layers {
+		if l.opt.Files {
+			img.Layers[i].Files = files[i]
+		}
+		layers[i] = img.Layers[i]
+		layers[i].Files = files[i]
+	}
+	merged := mergeFiles(layers)
+
+	if l.opt.Files {
+		img.Files = merged
+	}
+	if l.opt.Secrets {
+		img.Secrets = nil
+		for _, s := range secrets {
+			img.Secrets = append(img.Secrets, s...)
+		}
+		markDeleted(img.Secrets, merged)
+	}
+	return nil
+}
+
+// scanLayer streams layer, setting its uncompressed size and returning its
+// files and secrets according to the options.
+func (l *Loader) scanLayer(ctx context.Context, fetcher remotes.Fetcher, layer *Layer) ([]File, []Secret, error) {
+	rc, err := fetcher.Fetch(ctx, ocispec.Descriptor{
+		MediaType: layer.MediaType,
+		Digest:    layer.Digest,
+		Size:      layer.Size,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+
+	verifier := layer.Digest.Verifier()
+
+	// the compression is detected from the content rather than the media
+	// type, as docker save archives don't record it
+	dr, err := compression.DecompressStream(io.TeeReader(rc, verifier))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dr.Close()
+
+	cr := &countingReader{r: dr}
+
+	var files []File
+	var secrets *secretScanner
+	if l.opt.Files || l.opt.Secrets {
+		if l.opt.Secrets {
+			secrets = newSecretScanner(layer.Digest)
+		}
+		err := walkFiles(cr, func(f File, r io.Reader) error {
+			files = append(files, f)
+			if secrets != nil {
+				return secrets.scan(f, r)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// drain the end of the archive and any trailing data so that the size
+	// is complete and the whole blob is verified
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		return nil, nil, err
+	}
+	if !verifier.Verified() {
+		return nil, nil, errors.Errorf("digest mismatch for layer %s", layer.Digest)
+	}
+
+	if l.opt.UncompressedSize {
+		layer.UncompressedSize = cr.n
+	}
+	if secrets != nil {
+		return files, secrets.secrets, nil
+	}
+	return files, nil, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
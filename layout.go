@@ -0,0 +1,197 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	distref "github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	"github.com/moby/buildkit/util/imageutil"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// layoutStore provides access to the files of an OCI image layout by their
+// slash-separated path relative to the layout root.
+type layoutStore interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+type dirStore string
+
+func (d dirStore) Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(errdefs.ErrNotFound, "%s not found", name)
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// LayoutResolver resolves references against an OCI image layout.
+//
+// Tags are matched against the "io.containerd.image.name" and
+// "org.opencontainers.image.ref.name" annotations of the descriptors in
+// index.json. If index.json holds a single descriptor without a name, any
+// tag resolves to it. Digests are resolved from index.json or directly from
+// the blobs directory.
+type LayoutResolver struct {
+	store layoutStore
+	index ocispec.Index
+}
+
+var _ remotes.Resolver = &LayoutResolver{}
+
+// NewLayoutResolver returns a resolver for the OCI image layout in dir, as
+// written by "buildx build --output type=oci,tar=false".
+func NewLayoutResolver(dir string) (*LayoutResolver, error) {
+	return newLayoutResolver(dirStore(dir))
+}
+
+func newLayoutResolver(store layoutStore) (*LayoutResolver, error) {
+	var layout ocispec.ImageLayout
+	if err := readLayoutJSON(store, ocispec.ImageLayoutFile, &layout); err != nil {
+		return nil, errors.Wrap(err, "not an oci layout")
+	}
+	if layout.Version != ocispec.ImageLayoutVersion {
+		return nil, errors.Errorf("unsupported oci layout version %q", layout.Version)
+	}
+	return newIndexResolver(store)
+}
+
+// newIndexResolver returns a resolver for the index.json of store, which
+// isn't required to hold the oci-layout file.
+func newIndexResolver(store layoutStore) (*LayoutResolver, error) {
+	var idx ocispec.Index
+	if err := readLayoutJSON(store, "index.json", &idx); err != nil {
+		return nil, err
+	}
+
+	return &LayoutResolver{
+		store: store,
+		index: idx,
+	}, nil
+}
+
+func (r *LayoutResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	named, err := distref.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", ocispec.Descriptor{}, errors.Wrapf(err, "failed to parse %q", ref)
+	}
+
+	if canonical, ok := named.(distref.Canonical); ok {
+		desc, err := r.resolveDigest(ctx, canonical.Digest())
+		return ref, desc, err
+	}
+
+	named = distref.TagNameOnly(named)
+	tagged, ok := named.(distref.Tagged)
+	if !ok {
+		return "", ocispec.Descriptor{}, errors.Errorf("reference %q has no tag", ref)
+	}
+
+	for _, desc := range r.index.Manifests {
+		if name, ok := desc.Annotations[images.AnnotationImageName]; ok {
+			if name == named.String() || name == distref.FamiliarString(named) {
+				return ref, desc, nil
+			}
+			continue
+		}
+		switch desc.Annotations[ocispec.AnnotationRefName] {
+		case named.String(), distref.FamiliarString(named), tagged.Tag():
+			return ref, desc, nil
+		}
+	}
+
+	if len(r.index.Manifests) == 1 {
+		desc := r.index.Manifests[0]
+		_, hasImageName := desc.Annotations[images.AnnotationImageName]
+		_, hasRefName := desc.Annotations[ocispec.AnnotationRefName]
+		if !hasImageName && !hasRefName {
+			return ref, desc, nil
+		}
+	}
+
+	return "", ocispec.Descriptor{}, errors.Wrapf(errdefs.ErrNotFound, "reference %s not found in oci layout", ref)
+}
+
+func (r *LayoutResolver) resolveDigest(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error) {
+	for _, desc := range r.index.Manifests {
+		if desc.Digest == dgst {
+			return desc, nil
+		}
+	}
+
+	dt, err := r.readBlob(ctx, dgst)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	mt, err := imageutil.DetectManifestBlobMediaType(dt)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return ocispec.Descriptor{
+		MediaType: mt,
+		Digest:    dgst,
+		Size:      int64(len(dt)),
+	}, nil
+}
+
+func (r *LayoutResolver) readBlob(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	rc, err := r.Fetch(ctx, ocispec.Descriptor{Digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (r *LayoutResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	return r, nil
+}
+
+func (r *LayoutResolver) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	if err := desc.Digest.Validate(); err != nil {
+		return nil, err
+	}
+	return r.store.Open(path.Join("blobs", desc.Digest.Algorithm().String(), desc.Digest.Hex()))
+}
+
+func (r *LayoutResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	return nil, errors.Wrap(errdefs.ErrNotImplemented, "pushing to oci layout is not supported")
+}
+
+func readLayoutJSON(store layoutStore, name string, v interface{}) error {
+	rc, err := store.Open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return errors.Wrapf(err, "failed to decode %s", name)
+	}
+	return nil
+}
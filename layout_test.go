@@ -0,0 +1,88 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/go-imageinspect/testutil"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Architecture: "arm64",
+		OS:           "linux",
+	})
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: []ocispec.Descriptor{
+			{Size: 100},
+		},
+		Annotations: map[string]string{
+			"org.opencontainers.image.title": "this is title",
+		},
+	})
+	require.NoError(t, err)
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			mfst.Descriptor,
+		},
+	})
+	require.NoError(t, err)
+
+	desc := idx.Descriptor
+	desc.Annotations = map[string]string{
+		"io.containerd.image.name":          "docker.io/library/test:v1",
+		"org.opencontainers.image.ref.name": "v1",
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, testutil.WriteLayout(dir, ocispec.Index{
+		Manifests: []ocispec.Descriptor{desc},
+	}, cfg, mfst, idx))
+
+	resolver, err := NewLayoutResolver(dir)
+	require.NoError(t, err)
+
+	l, err := NewLoader(Opt{
+		Resolver: resolver,
+	})
+	require.NoError(t, err)
+
+	for _, ref := range []string{"test:v1", "docker.io/library/test@" + idx.Descriptor.Digest.String(), "docker.io/library/test@" + mfst.Descriptor.Digest.String()} {
+		r, err := l.Load(ctx, ref)
+		require.NoError(t, err, ref)
+
+		require.Equal(t, []string{"linux/arm64"}, r.Platforms)
+
+		img, ok := r.Images["linux/arm64"]
+		require.True(t, ok)
+		require.Equal(t, "this is title", img.Title)
+		require.Equal(t, int64(100), img.Size)
+	}
+
+	_, err = l.Load(ctx, "test:v2")
+	require.Error(t, err)
+}
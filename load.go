@@ -16,6 +16,7 @@ package imageinspect
 
 import (
 	"context"
+	"crypto"
 	"encoding/json"
 	"path/filepath"
 	"sort"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/platforms"
 	distref "github.com/containerd/containerd/reference/docker"
@@ -48,17 +50,73 @@ type ContentCache interface {
 type Opt struct {
 	Resolver remotes.Resolver
 	CacheDir string
+
+	// Cosign enables discovery of signatures and attestations stored
+	// under the "sha256-<hex>.sig" and "sha256-<hex>.att" tags used by
+	// cosign.
+	Cosign bool
+
+	// PublicKeys are used to verify signatures. Signatures that can't be
+	// verified with any of the keys are reported as not verified.
+	PublicKeys []crypto.PublicKey
+
+	// TrustedRoot enables offline verification of keyless signatures with
+	// certificates issued by its certificate authorities and logged in its
+	// transparency logs.
+	TrustedRoot *TrustedRoot
+
+	// NotationTrust enables verification of Notary Project signatures
+	// against a trust store and trust policy. Without it, notation
+	// signatures are reported as not verified.
+	NotationTrust *NotationTrust
+
+	// Platforms limits the images of an index that are fetched and scanned
+	// to the ones matching it. Images without a platform in the index are
+	// matched with the platform of their config. Load fails with a not
+	// found error if no image matches. All images are loaded if Platforms
+	// is nil.
+	Platforms platforms.MatchComparer
+
+	// BestPlatformOnly limits the images of an index to the single image
+	// Platforms ranks first, using platforms.Default() if Platforms is nil.
+	BestPlatformOnly bool
+
+	// Parts are the parts of the image metadata to load. Attestations and
+	// signatures that aren't needed for them are not fetched. All parts are
+	// loaded if Parts is zero.
+	Parts Part
+
+	// Lenient collects failures to read attestations, signatures and other
+	// optional metadata in the Errors of the result and its images instead
+	// of failing Load.
+	Lenient bool
+
+	// UncompressedSize fetches every layer to compute its uncompressed
+	// size, which is the size the image takes once unpacked. It requires
+	// the layers part.
+	UncompressedSize bool
+
+	// Files fetches every layer to list its files and the files of the
+	// final filesystem of the image. It requires the layers part.
+	Files bool
+
+	// Secrets fetches every layer to look for files that likely contain
+	// secrets, such as private keys and credentials. It requires the layers
+	// part.
+	Secrets bool
 }
 
 type Loader struct {
 	opt *Opt
 
 	cache ContentCache
+	keys  []publicKey
 }
 
 type manifest struct {
-	desc     ocispec.Descriptor
-	manifest ocispec.Manifest
+	desc         ocispec.Descriptor
+	manifest     ocispec.Manifest
+	artifactType string
 }
 
 type index struct {
@@ -72,6 +130,11 @@ type result struct {
 	manifests map[digest.Digest]manifest
 	images    map[string]digest.Digest
 	refs      map[digest.Digest][]digest.Digest
+	cosign    map[digest.Digest]cosignArtifacts
+	errors    []Error
+	// imageErrors are the errors of the image manifests, recorded while
+	// fetching
+	imageErrors map[digest.Digest][]Error
 }
 
 func newResult() *result {
@@ -80,6 +143,9 @@ func newResult() *result {
 		manifests: make(map[digest.Digest]manifest),
 		images:    make(map[string]digest.Digest),
 		refs:      make(map[digest.Digest][]digest.Digest),
+		cosign:    make(map[digest.Digest]cosignArtifacts),
+
+		imageErrors: make(map[digest.Digest][]Error),
 	}
 }
 
@@ -98,6 +164,12 @@ func NewLoader(opt Opt) (*Loader, error) {
 		l.cache = contentutil.NewBuffer()
 	}
 
+	keys, err := newPublicKeys(opt.PublicKeys)
+	if err != nil {
+		return nil, err
+	}
+	l.keys = keys
+
 	return l, nil
 }
 
@@ -133,6 +205,7 @@ func (l *Loader) Load(ctx context.Context, ref string) (*Result, error) {
 	}
 
 	rr.Digest = desc.Digest
+	rr.GeneratedManifest = desc.Annotations[annotationGeneratedManifest] == "true"
 
 	if _, ok := r.manifests[desc.Digest]; ok {
 		rr.ResultType = Manifest
@@ -142,46 +215,112 @@ func (l *Loader) Load(ctx context.Context, ref string) (*Result, error) {
 		rr.ResultType = Unknown
 	}
 
+	// signatures may refer to the index as well as to the platform manifests
+	subjects := make([]digest.Digest, 0, len(r.images)+1)
+	for _, dgst := range r.images {
+		subjects = append(subjects, dgst)
+	}
+	if rr.ResultType == Index {
+		subjects = append(subjects, desc.Digest)
+	}
+
+	if l.want(PartSBOM | PartProvenance | PartSignatures) {
+		if err := l.fetchReferrers(ctx, named, fetcher, r, subjects); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.opt.Cosign && l.want(PartSBOM|PartProvenance|PartSignatures) {
+		if err := l.fetchCosign(ctx, named, r, subjects); err != nil {
+			return nil, err
+		}
+	}
+
 	for platform, dgst := range r.images {
 		rr.Platforms = append(rr.Platforms, platform)
 
+		var img Image
+
+		img.Platform = platform
+		img.Errors = r.imageErrors[dgst]
+
 		mfst, ok := r.manifests[dgst]
 		if !ok {
+			if len(img.Errors) > 0 {
+				rr.Images[platform] = img
+				continue
+			}
 			return nil, errors.Errorf("image %s not found", platform)
 		}
 
-		var img Image
-
-		var size int64
-
 		for _, layer := range mfst.manifest.Layers {
-			size += layer.Size
+			img.Size += layer.Size
 		}
 
-		img.Size = size
-		img.Platform = platform
-
-		annotations := make(map[string]string, len(mfst.manifest.Annotations)+len(mfst.desc.Annotations))
-		for k, v := range mfst.desc.Annotations {
-			annotations[k] = v
+		var config *imageConfig
+		if l.want(PartConfig | PartLayers | PartProvenance) {
+			config, err = l.readConfig(ctx, fetcher, mfst.manifest.Config)
+			if err := l.recordError(&img.Errors, ComponentConfig, mfst.manifest.Config.Digest, err); err != nil {
+				return nil, err
+			}
 		}
-		for k, v := range mfst.manifest.Annotations {
-			annotations[k] = v
+
+		if l.want(PartConfig) {
+			var labels map[string]string
+			if config != nil {
+				labels = config.Config.Labels
+				addConfig(&img, config)
+			}
+			addAnnotations(&img, mergeAnnotations(labels, mfst))
 		}
 
-		if title, ok := annotations[AnnotationImageTitle]; ok {
-			img.Title = title
+		if l.want(PartLayers) {
+			addLayers(&img, config, mfst.manifest.Layers)
+			if config != nil {
+				addHistory(&img, config, mfst.manifest.Layers)
+			}
+			if l.opt.UncompressedSize || l.opt.Files || l.opt.Secrets {
+				if err := l.scanLayers(ctx, fetcher, &img); err != nil {
+					if err := l.recordError(&img.Errors, ComponentLayers, dgst, err); err != nil {
+						return nil, err
+					}
+				}
+			}
 		}
 
 		refs, ok := r.refs[dgst]
 		if ok {
-			if err := l.scanSBOM(ctx, fetcher, r, dgst, refs, &img); err != nil {
-				return nil, err // TODO: these errors should likely be stored in the result
+			if err := l.scanAttestations(ctx, fetcher, r, dgst, refs, &img); err != nil {
+				return nil, err
 			}
 		}
 
-		if err := l.scanBuildInfo(ctx, fetcher, mfst.manifest.Config, &img); err != nil {
-			return nil, err
+		// signatures of the index cover all platforms
+		signed := []digest.Digest{dgst}
+		if rr.ResultType == Index {
+			signed = append(signed, desc.Digest)
+		}
+
+		if l.opt.Cosign {
+			if err := l.scanCosign(ctx, fetcher, r, signed, &img); err != nil {
+				return nil, err
+			}
+		}
+
+		if l.want(PartSignatures) {
+			for _, subject := range signed {
+				if err := l.scanNotation(ctx, fetcher, r, named.Name(), subject, &img); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if l.want(PartProvenance) && config != nil {
+			if err := scanBuildInfo(config, &img); err != nil {
+				if err := l.recordError(&img.Errors, ComponentProvenance, mfst.manifest.Config.Digest, err); err != nil {
+					return nil, err
+				}
+			}
 		}
 
 		rr.Images[platform] = img
@@ -190,12 +329,213 @@ func (l *Loader) Load(ctx context.Context, ref string) (*Result, error) {
 
 	sort.Strings(rr.Platforms)
 
+	rr.Errors = r.errors
+
+	// errors of manifests referring to digests that aren't images
+	for _, dgst := range r.images {
+		delete(r.imageErrors, dgst)
+	}
+	orphans := make([]digest.Digest, 0, len(r.imageErrors))
+	for dgst := range r.imageErrors {
+		orphans = append(orphans, dgst)
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i] < orphans[j] })
+	for _, dgst := range orphans {
+		rr.Errors = append(rr.Errors, r.imageErrors[dgst]...)
+	}
+
 	return rr, nil
 }
 
+// filterManifests returns the descriptors of the index desc that should be
+// loaded according to the platform and part options. Attestation manifests are
+// kept along with the image they refer to, if SBOMs or provenance are loaded.
+// They only hold in-toto statements, so signatures alone don't need them.
+func (l *Loader) filterManifests(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, descs []ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	if !l.want(PartSBOM | PartProvenance) {
+		filtered := make([]ocispec.Descriptor, 0, len(descs))
+		for _, d := range descs {
+			if _, ok := d.Annotations[AnnotationReference]; !ok {
+				filtered = append(filtered, d)
+			}
+		}
+		descs = filtered
+	}
+
+	matcher := l.opt.Platforms
+	if matcher == nil {
+		if !l.opt.BestPlatformOnly {
+			return descs, nil
+		}
+		matcher = platforms.Default()
+	}
+
+	descs = l.resolvePlatforms(ctx, fetcher, descs)
+
+	var best *ocispec.Platform
+	var bestDigest digest.Digest
+	var candidates int
+	match := map[digest.Digest]struct{}{}
+	for _, d := range descs {
+		if _, ok := d.Annotations[AnnotationReference]; ok {
+			continue
+		}
+		candidates++
+		if d.Platform == nil {
+			// nested indexes and manifests whose platform can't be read
+			// are kept, fetching them reports the error
+			match[d.Digest] = struct{}{}
+			continue
+		}
+		if !matcher.Match(*d.Platform) {
+			continue
+		}
+		if l.opt.BestPlatformOnly {
+			if best == nil || matcher.Less(*d.Platform, *best) {
+				best, bestDigest = d.Platform, d.Digest
+			}
+			continue
+		}
+		match[d.Digest] = struct{}{}
+	}
+	if best != nil {
+		match[bestDigest] = struct{}{}
+	}
+	if candidates > 0 && len(match) == 0 {
+		return nil, errors.Wrapf(errdefs.ErrNotFound, "no match for platform in manifest %s", desc.Digest)
+	}
+
+	out := make([]ocispec.Descriptor, 0, len(match))
+	for _, d := range descs {
+		key := d.Digest
+		if ref, ok := d.Annotations[AnnotationReference]; ok {
+			key = digest.Digest(ref)
+		}
+		if _, ok := match[key]; ok {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// resolvePlatforms returns descs with the platform of the image manifests that
+// have none in the index read from their config. Descriptors whose platform
+// can't be read are left unchanged.
+func (l *Loader) resolvePlatforms(ctx context.Context, fetcher remotes.Fetcher, descs []ocispec.Descriptor) []ocispec.Descriptor {
+	out := make([]ocispec.Descriptor, len(descs))
+	copy(out, descs)
+
+	var wg sync.WaitGroup
+	for i := range out {
+		d := &out[i]
+		if _, ok := d.Annotations[AnnotationReference]; ok || d.Platform != nil {
+			continue
+		}
+		switch d.MediaType {
+		case images.MediaTypeDockerSchema2Manifest, ocispec.MediaTypeImageManifest:
+		default:
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dt, err := l.readBlob(ctx, fetcher, *d)
+			if err != nil {
+				return
+			}
+			var mfst ocispec.Manifest
+			if err := json.Unmarshal(dt, &mfst); err != nil {
+				return
+			}
+			if p, err := l.readPlatformFromConfig(ctx, fetcher, mfst.Config); err == nil {
+				d.Platform = p
+			}
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// ParsePlatforms returns a platform matcher for the platform specifiers,
+// ranking them in the given order.
+func ParsePlatforms(specifiers ...string) (platforms.MatchComparer, error) {
+	ps := make([]ocispec.Platform, len(specifiers))
+	for i, s := range specifiers {
+		p, err := platforms.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		ps[i] = p
+	}
+	return platforms.Ordered(ps...), nil
+}
+
+// recordFetchError is recordError for a failure to fetch the manifest desc.
+// The error is recorded against the image the manifest belongs to: the
+// subject of an attestation manifest, or the platform of an image manifest.
+func (r *result) recordFetchError(l *Loader, desc ocispec.Descriptor, err error) error {
+	if err == nil || !l.opt.Lenient {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	component := ComponentManifest
+	var image digest.Digest
+	if ref, ok := desc.Annotations[AnnotationReference]; ok {
+		component = ComponentAttestation
+		image, _ = digest.Parse(ref)
+	} else if desc.Platform != nil {
+		image = desc.Digest
+		r.images[platforms.Format(platforms.Normalize(*desc.Platform))] = image
+	}
+	return r.recordImageError(l, image, component, desc.Digest, err)
+}
+
+// recordSubjectError is recordError for a failure to discover the artifacts
+// referring to subject. The error is recorded against the image if subject is
+// an image manifest.
+func (r *result) recordSubjectError(l *Loader, component Component, subject digest.Digest, err error) error {
+	if err == nil || !l.opt.Lenient {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recordImageError(l, subject, component, subject, err)
+}
+
+// recordImageError records err against image, or in the errors of the result
+// if image is empty or an index. r.mu must be held.
+func (r *result) recordImageError(l *Loader, image digest.Digest, component Component, dgst digest.Digest, err error) error {
+	if _, ok := r.indexes[image]; ok || image == "" {
+		return l.recordError(&r.errors, component, dgst, err)
+	}
+	errs := r.imageErrors[image]
+	err = l.recordError(&errs, component, dgst, err)
+	r.imageErrors[image] = errs
+	return err
+}
+
+// recordError returns err unless the loader is lenient, in which case err is
+// appended to errs and nil is returned.
+func (l *Loader) recordError(errs *[]Error, component Component, dgst digest.Digest, err error) error {
+	if err == nil || !l.opt.Lenient {
+		return err
+	}
+	*errs = append(*errs, Error{
+		Component: component,
+		Digest:    dgst,
+		Cause:     err,
+	})
+	return nil
+}
+
 func (l *Loader) fetch(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, r *result) error {
 	_, err := remotes.FetchHandler(l.cache, fetcher)(ctx, desc)
 	if err != nil {
+		if _, ok := desc.Annotations[AnnotationReference]; ok {
+			return errors.Wrapf(err, "failed to fetch attestation manifest %s", desc.Digest)
+		}
 		return err
 	}
 
@@ -209,10 +549,18 @@ func (l *Loader) fetch(ctx context.Context, fetcher remotes.Fetcher, desc ocispe
 		if err := json.Unmarshal(dt, &mfst); err != nil {
 			return err
 		}
+		// image-spec v1.0 has no artifactType field
+		var artifact struct {
+			ArtifactType string `json:"artifactType"`
+		}
+		if err := json.Unmarshal(dt, &artifact); err != nil {
+			return err
+		}
 		r.mu.Lock()
 		r.manifests[desc.Digest] = manifest{
-			desc:     desc,
-			manifest: mfst,
+			desc:         desc,
+			manifest:     mfst,
+			artifactType: artifact.ArtifactType,
 		}
 		r.mu.Unlock()
 
@@ -223,7 +571,9 @@ func (l *Loader) fetch(ctx context.Context, fetcher remotes.Fetcher, desc ocispe
 				return err
 			}
 			r.mu.Lock()
-			r.refs[refdgst] = append(r.refs[refdgst], desc.Digest)
+			if !containsDigest(r.refs[refdgst], desc.Digest) {
+				r.refs[refdgst] = append(r.refs[refdgst], desc.Digest)
+			}
 			r.mu.Unlock()
 		} else {
 			p := desc.Platform
@@ -256,11 +606,16 @@ func (l *Loader) fetch(ctx context.Context, fetcher remotes.Fetcher, desc ocispe
 		}
 		r.mu.Unlock()
 
+		descs, err := l.filterManifests(ctx, fetcher, desc, idx.Manifests)
+		if err != nil {
+			return err
+		}
+
 		eg, ctx := errgroup.WithContext(ctx)
-		for _, d := range idx.Manifests {
+		for _, d := range descs {
 			d := d
 			eg.Go(func() error {
-				return l.fetch(ctx, fetcher, d, r)
+				return r.recordFetchError(l, d, l.fetch(ctx, fetcher, d, r))
 			})
 		}
 
@@ -272,7 +627,7 @@ func (l *Loader) fetch(ctx context.Context, fetcher remotes.Fetcher, desc ocispe
 	return nil
 }
 
-func (l *Loader) readPlatformFromConfig(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) (*ocispec.Platform, error) {
+func (l *Loader) readConfig(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) (*imageConfig, error) {
 	_, err := remotes.FetchHandler(l.cache, fetcher)(ctx, desc)
 	if err != nil {
 		return nil, err
@@ -283,10 +638,18 @@ func (l *Loader) readPlatformFromConfig(ctx context.Context, fetcher remotes.Fet
 		return nil, err
 	}
 
-	var config ocispec.Image
+	var config imageConfig
 	if err := json.Unmarshal(dt, &config); err != nil {
 		return nil, err
 	}
+	return &config, nil
+}
+
+func (l *Loader) readPlatformFromConfig(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) (*ocispec.Platform, error) {
+	config, err := l.readConfig(ctx, fetcher, desc)
+	if err != nil {
+		return nil, err
+	}
 
 	return &ocispec.Platform{
 		OS:           config.OS,
@@ -295,6 +658,15 @@ func (l *Loader) readPlatformFromConfig(ctx context.Context, fetcher remotes.Fet
 	}, nil
 }
 
+func containsDigest(dgsts []digest.Digest, dgst digest.Digest) bool {
+	for _, d := range dgsts {
+		if d == dgst {
+			return true
+		}
+	}
+	return false
+}
+
 func parseReference(ref string) (distref.Named, error) {
 	named, err := distref.ParseNormalizedNamed(ref)
 	if err != nil {
@@ -15,11 +15,19 @@
 package imageinspect
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/platforms"
 	"github.com/docker/go-imageinspect/testutil"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -197,3 +205,762 @@ func TestTitle(t *testing.T) {
 
 	require.Equal(t, "this is title", img.Title)
 }
+
+func TestAnnotations(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Config: ocispec.ImageConfig{
+			Labels: map[string]string{
+				"org.opencontainers.image.title":   "label title",
+				"org.opencontainers.image.vendor":  "label vendor",
+				"org.opencontainers.image.authors": "label author",
+				"org.opencontainers.image.url":     "https://example.com",
+			},
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Annotations: map[string]string{
+			"org.opencontainers.image.title":       "manifest title",
+			"org.opencontainers.image.description": "first line\nsecond line",
+			"org.opencontainers.image.licenses":    "Apache-2.0",
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	desc := mfst.Descriptor
+	desc.Annotations = map[string]string{
+		"org.opencontainers.image.title":    "descriptor title",
+		"org.opencontainers.image.vendor":   "descriptor vendor",
+		"org.opencontainers.image.source":   "https://github.com/docker/go-imageinspect",
+		"org.opencontainers.image.revision": "abcdef",
+	}
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{desc},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		CacheDir: t.TempDir(),
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img, ok := r.Images["linux/amd64"]
+	require.True(t, ok)
+
+	require.Equal(t, "manifest title", img.Title)
+	require.Equal(t, "descriptor vendor", img.Vendor)
+	require.Equal(t, "label author", img.Author)
+	require.Equal(t, "https://example.com", img.URL)
+	require.Equal(t, "https://github.com/docker/go-imageinspect", img.Source)
+	require.Equal(t, "abcdef", img.Revision)
+	require.Equal(t, "first line\nsecond line", img.Description)
+	require.Equal(t, "first line", img.ShortDescription)
+	require.Equal(t, "Apache-2.0", img.License)
+	require.Equal(t, "", img.Documentation)
+}
+
+func TestLenient(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	var descs []ocispec.Descriptor
+	var stmt *testutil.Blob
+	for _, arch := range []string{"amd64", "arm64"} {
+		cfg, err := testutil.Config(ocispec.Image{
+			Architecture: arch,
+			OS:           "linux",
+		})
+		require.NoError(t, err)
+		_, err = env.AddBlob(cfg)
+		require.NoError(t, err)
+
+		mfst, err := testutil.Manifest(ocispec.Manifest{
+			Config: cfg.Descriptor,
+		})
+		require.NoError(t, err)
+		_, err = env.AddBlob(mfst)
+		require.NoError(t, err)
+		descs = append(descs, mfst.Descriptor)
+
+		if arch == "amd64" {
+			// malformed SBOM
+			stmt, err = testutil.Statement(mfst.Descriptor, "https://spdx.dev/Document", "invalid")
+			require.NoError(t, err)
+			_, err = env.AddBlob(stmt)
+			require.NoError(t, err)
+
+			att, err := testutil.AttestationManifest(mfst.Descriptor, stmt.Descriptor)
+			require.NoError(t, err)
+			_, err = env.AddBlob(att)
+			require.NoError(t, err)
+			descs = append(descs, att.Descriptor)
+		}
+	}
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: descs,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	_, err = l.Load(ctx, "test")
+	require.Error(t, err)
+
+	l, err = NewLoader(Opt{
+		Resolver: env,
+		Lenient:  true,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"linux/amd64", "linux/arm64"}, r.Platforms)
+	require.Empty(t, r.Errors)
+	require.Empty(t, r.Images["linux/arm64"].Errors)
+
+	errs := r.Images["linux/amd64"].Errors
+	require.Equal(t, 1, len(errs))
+	require.Equal(t, ComponentAttestation, errs[0].Component)
+	require.Equal(t, stmt.Descriptor.Digest, errs[0].Digest)
+	require.Error(t, errs[0].Cause)
+	require.Nil(t, r.Images["linux/amd64"].SBOM)
+}
+
+func TestLenientFetch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	// attestation manifest and arm64 manifest missing from the registry
+	stmt, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{})
+	require.NoError(t, err)
+	att, err := testutil.AttestationManifest(mfst.Descriptor, stmt.Descriptor)
+	require.NoError(t, err)
+
+	missing, err := testutil.Manifest(ocispec.Manifest{
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromString("missing"),
+			Size:      7,
+		},
+	})
+	require.NoError(t, err)
+	missing.Descriptor.Platform = &ocispec.Platform{Architecture: "arm64", OS: "linux"}
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{mfst.Descriptor, att.Descriptor, missing.Descriptor},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	_, err = l.Load(ctx, "test")
+	require.Error(t, err)
+
+	l, err = NewLoader(Opt{
+		Resolver: env,
+		Lenient:  true,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"linux/amd64", "linux/arm64"}, r.Platforms)
+	require.Empty(t, r.Errors)
+
+	errs := r.Images["linux/amd64"].Errors
+	require.Equal(t, 1, len(errs))
+	require.Equal(t, ComponentAttestation, errs[0].Component)
+	require.Equal(t, att.Descriptor.Digest, errs[0].Digest)
+	require.Equal(t, "linux/amd64", r.Images["linux/amd64"].Platform)
+
+	errs = r.Images["linux/arm64"].Errors
+	require.Equal(t, 1, len(errs))
+	require.Equal(t, ComponentManifest, errs[0].Component)
+	require.Equal(t, missing.Descriptor.Digest, errs[0].Digest)
+
+	// recorded errors are usable as error values
+	var target Error
+	require.True(t, errors.As(error(errs[0]), &target))
+	require.Equal(t, errs[0].Cause, errors.Unwrap(error(errs[0])))
+}
+
+// failingDiscovery is a resolver that fails to discover referrers and cosign
+// artifacts with an unexpected error.
+type failingDiscovery struct {
+	failingReferrers
+}
+
+func (f failingDiscovery) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	if strings.Contains(ref, ":sha256-") {
+		return "", ocispec.Descriptor{}, errors.Errorf("unexpected status resolving %s: 500 Internal Server Error", ref)
+	}
+	return f.Env.Resolve(ctx, ref)
+}
+
+func TestLenientDiscovery(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{mfst.Descriptor},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: failingDiscovery{failingReferrers{env}},
+		Cosign:   true,
+		Lenient:  true,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	components := func(errs []Error, dgst digest.Digest) []Component {
+		var c []Component
+		for _, err := range errs {
+			require.Equal(t, dgst, err.Digest)
+			c = append(c, err.Component)
+		}
+		return c
+	}
+	expected := []Component{ComponentReferrers, ComponentSignature, ComponentAttestation}
+
+	// errors for the index are kept in the result, errors for the image
+	// are recorded against it
+	require.ElementsMatch(t, expected, components(r.Errors, idx.Descriptor.Digest))
+	require.ElementsMatch(t, expected, components(r.Images["linux/amd64"].Errors, mfst.Descriptor.Digest))
+}
+
+func TestPlatforms(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	var descs []ocispec.Descriptor
+	for _, p := range []string{"linux/amd64", "linux/arm64", "linux/arm/v7", "linux/s390x"} {
+		platform := platforms.MustParse(p)
+		cfg, err := testutil.Config(ocispec.Image{
+			Architecture: platform.Architecture,
+			OS:           platform.OS,
+			Variant:      platform.Variant,
+		})
+		require.NoError(t, err)
+		_, err = env.AddBlob(cfg)
+		require.NoError(t, err)
+
+		mfst, err := testutil.Manifest(ocispec.Manifest{
+			Config: cfg.Descriptor,
+		})
+		require.NoError(t, err)
+		_, err = env.AddBlob(mfst)
+		require.NoError(t, err)
+		// the platform of the s390x image is only in its config
+		if p != "linux/s390x" {
+			mfst.Descriptor.Platform = &platform
+		}
+		descs = append(descs, mfst.Descriptor)
+
+		stmt, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+			"builder": map[string]string{"id": p},
+		})
+		require.NoError(t, err)
+		_, err = env.AddBlob(stmt)
+		require.NoError(t, err)
+
+		att, err := testutil.AttestationManifest(mfst.Descriptor, stmt.Descriptor)
+		require.NoError(t, err)
+		_, err = env.AddBlob(att)
+		require.NoError(t, err)
+		descs = append(descs, att.Descriptor)
+	}
+
+	// the blobs of this image are missing, so loading fails unless it is
+	// filtered out
+	descs = append(descs, ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString("missing"),
+		Size:      7,
+		Platform:  &ocispec.Platform{OS: "linux", Architecture: "riscv64"},
+	})
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: descs,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	for _, tc := range []struct {
+		name      string
+		platforms []string
+		best      bool
+		expected  []string
+	}{
+		{name: "single", platforms: []string{"linux/arm64"}, expected: []string{"linux/arm64"}},
+		{name: "multiple", platforms: []string{"linux/arm/v7", "linux/amd64"}, expected: []string{"linux/amd64", "linux/arm/v7"}},
+		{name: "best", platforms: []string{"linux/arm/v7", "linux/amd64"}, best: true, expected: []string{"linux/arm/v7"}},
+		{name: "config", platforms: []string{"linux/s390x"}, expected: []string{"linux/s390x"}},
+		{name: "best config", platforms: []string{"linux/s390x", "linux/amd64"}, best: true, expected: []string{"linux/s390x"}},
+		{name: "none", platforms: []string{"windows/amd64"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			matcher, err := ParsePlatforms(tc.platforms...)
+			require.NoError(t, err)
+
+			l, err := NewLoader(Opt{
+				Resolver:         env,
+				Platforms:        matcher,
+				BestPlatformOnly: tc.best,
+			})
+			require.NoError(t, err)
+
+			r, err := l.Load(ctx, "test")
+			if tc.expected == nil {
+				require.Error(t, err)
+				require.True(t, errdefs.IsNotFound(err))
+				return
+			}
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, r.Platforms)
+			for _, p := range tc.expected {
+				img := r.Images[p]
+				require.NotNil(t, img.Provenance)
+				require.Equal(t, p, img.Provenance.BuilderID)
+			}
+		})
+	}
+
+}
+
+func TestParts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	cfg, err := testutil.Config(ocispec.Image{
+		Config: ocispec.ImageConfig{
+			Labels: map[string]string{"org.opencontainers.image.title": "test"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: []ocispec.Descriptor{
+			{Size: 25},
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	prov, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+		"builder": map[string]string{"id": "test"},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(prov)
+	require.NoError(t, err)
+
+	// the SBOM is never added, so loading fails if it is fetched
+	sbom, err := testutil.Statement(mfst.Descriptor, "https://spdx.dev/Document", map[string]interface{}{})
+	require.NoError(t, err)
+
+	att, err := testutil.AttestationManifest(mfst.Descriptor, prov.Descriptor, sbom.Descriptor)
+	require.NoError(t, err)
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			mfst.Descriptor,
+			att.Descriptor,
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	// the attestation manifest is missing as well
+	parts, err := ParseParts("config,layers")
+	require.NoError(t, err)
+	l, err := NewLoader(Opt{
+		Resolver: env,
+		Parts:    parts,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img := r.Images["linux/amd64"]
+	require.Equal(t, "test", img.Title)
+	require.Equal(t, int64(25), img.Size)
+	require.Nil(t, img.Provenance)
+
+	// signatures don't need the attestation manifest either
+	l, err = NewLoader(Opt{
+		Resolver: env,
+		Parts:    PartSignatures,
+	})
+	require.NoError(t, err)
+
+	r, err = l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img = r.Images["linux/amd64"]
+	require.Equal(t, "", img.Title)
+	require.Equal(t, int64(25), img.Size)
+	require.Nil(t, img.Provenance)
+
+	_, err = env.AddBlob(att)
+	require.NoError(t, err)
+
+	l, err = NewLoader(Opt{
+		Resolver: env,
+		Parts:    PartProvenance,
+	})
+	require.NoError(t, err)
+
+	r, err = l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img = r.Images["linux/amd64"]
+	require.Equal(t, "", img.Title)
+	require.Equal(t, int64(25), img.Size)
+	require.NotNil(t, img.Provenance)
+	require.Equal(t, "test", img.Provenance.BuilderID)
+	require.Nil(t, img.SBOM)
+
+	// all parts, including the missing SBOM
+	l, err = NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	_, err = l.Load(ctx, "test")
+	require.Error(t, err)
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	dt := []byte(`{
+	"created": "2022-11-22T10:00:00Z",
+	"architecture": "amd64",
+	"os": "windows",
+	"os.version": "10.0.17763.1",
+	"os.features": ["win32k"],
+	"config": {
+		"User": "app",
+		"ExposedPorts": {"8080/tcp": {}, "443/tcp": {}},
+		"Env": ["PATH=/usr/bin"],
+		"Entrypoint": ["/app"],
+		"Cmd": ["serve"],
+		"Volumes": {"/data": {}},
+		"WorkingDir": "/srv",
+		"Labels": {"foo": "bar"},
+		"StopSignal": "SIGTERM",
+		"Healthcheck": {
+			"Test": ["CMD", "/app", "health"],
+			"Interval": 30000000000,
+			"Timeout": 5000000000,
+			"Retries": 3
+		}
+	},
+	"rootfs": {"type": "layers", "diff_ids": []}
+}`)
+	cfg := &testutil.Blob{
+		Data: dt,
+		Descriptor: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(dt),
+			Size:      int64(len(dt)),
+		},
+	}
+	_, err := env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", mfst.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img := r.Images["windows/amd64"]
+	require.NotNil(t, img.Config)
+
+	created := time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)
+	require.Equal(t, &Config{
+		Created:      &created,
+		User:         "app",
+		ExposedPorts: []string{"443/tcp", "8080/tcp"},
+		Env:          []string{"PATH=/usr/bin"},
+		Entrypoint:   []string{"/app"},
+		Cmd:          []string{"serve"},
+		Volumes:      []string{"/data"},
+		WorkingDir:   "/srv",
+		Labels:       map[string]string{"foo": "bar"},
+		StopSignal:   "SIGTERM",
+		Healthcheck: &Healthcheck{
+			Test:     []string{"CMD", "/app", "health"},
+			Interval: 30 * time.Second,
+			Timeout:  5 * time.Second,
+			Retries:  3,
+		},
+		OSVersion:  "10.0.17763.1",
+		OSFeatures: []string{"win32k"},
+	}, img.Config)
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	created := time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)
+	cfg, err := testutil.Config(ocispec.Image{
+		History: []ocispec.History{
+			{Created: &created, CreatedBy: "/bin/sh -c #(nop) ADD file:abc in /"},
+			{Created: &created, CreatedBy: "/bin/sh -c #(nop)  CMD [\"sh\"]", EmptyLayer: true},
+			{Created: &created, CreatedBy: "RUN apk add git", Comment: "buildkit.dockerfile.v0"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	layers := []ocispec.Descriptor{
+		{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("base"), Size: 100},
+		{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("git"), Size: 20},
+	}
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: layers,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", mfst.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	require.Equal(t, []History{
+		{
+			Created:   &created,
+			CreatedBy: "/bin/sh -c #(nop) ADD file:abc in /",
+			Layer:     layers[0].Digest,
+			Size:      100,
+		},
+		{
+			Created:    &created,
+			CreatedBy:  "/bin/sh -c #(nop)  CMD [\"sh\"]",
+			EmptyLayer: true,
+		},
+		{
+			Created:   &created,
+			CreatedBy: "RUN apk add git",
+			Comment:   "buildkit.dockerfile.v0",
+			Layer:     layers[1].Digest,
+			Size:      20,
+		},
+	}, r.Images["linux/amd64"].History)
+}
+
+func TestLayers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewEnv(t)
+
+	tarData := bytes.Repeat([]byte("layer"), 1000)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(tarData)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	var layers []ocispec.Descriptor
+	for _, b := range []*testutil.Blob{
+		{Data: buf.Bytes(), Descriptor: ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip}},
+		{Data: tarData, Descriptor: ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayer, Annotations: map[string]string{"foo": "bar"}}},
+	} {
+		b.Descriptor.Digest = digest.FromBytes(b.Data)
+		b.Descriptor.Size = int64(len(b.Data))
+		_, err := env.AddBlob(b)
+		require.NoError(t, err)
+		layers = append(layers, b.Descriptor)
+	}
+
+	diffID := digest.FromBytes(tarData)
+	cfg, err := testutil.Config(ocispec.Image{
+		RootFS: ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{diffID, diffID},
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: layers,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", mfst.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img := r.Images["linux/amd64"]
+	require.Equal(t, []Layer{
+		{
+			MediaType: ocispec.MediaTypeImageLayerGzip,
+			Digest:    layers[0].Digest,
+			Size:      layers[0].Size,
+			DiffID:    diffID,
+		},
+		{
+			MediaType:   ocispec.MediaTypeImageLayer,
+			Digest:      layers[1].Digest,
+			Size:        layers[1].Size,
+			DiffID:      diffID,
+			Annotations: map[string]string{"foo": "bar"},
+		},
+	}, img.Layers)
+	require.Equal(t, int64(0), img.UncompressedSize)
+
+	l, err = NewLoader(Opt{
+		Resolver:         env,
+		UncompressedSize: true,
+	})
+	require.NoError(t, err)
+
+	r, err = l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	img = r.Images["linux/amd64"]
+	require.Len(t, img.Layers, 2)
+	require.Equal(t, int64(len(tarData)), img.Layers[0].UncompressedSize)
+	require.Equal(t, int64(len(tarData)), img.Layers[1].UncompressedSize)
+	require.Equal(t, int64(2*len(tarData)), img.UncompressedSize)
+	require.Equal(t, layers[0].Size+layers[1].Size, img.Size)
+}
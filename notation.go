@@ -0,0 +1,706 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/veraison/go-cose"
+)
+
+const (
+	ArtifactTypeNotation     = "application/vnd.cncf.notary.signature"
+	MediaTypeJWS             = "application/jose+json"
+	MediaTypeCOSE            = "application/cose"
+	MediaTypeNotationPayload = "application/vnd.cncf.notary.payload.v1+json"
+
+	notationSigningScheme     = "io.cncf.notary.signingScheme"
+	notationSigningTime       = "io.cncf.notary.signingTime"
+	notationAuthenticTime     = "io.cncf.notary.authenticSigningTime"
+	notationExpiry            = "io.cncf.notary.expiry"
+	notationSchemeX509        = "notary.x509"
+	notationSchemeX509Signing = "notary.x509.signingAuthority"
+)
+
+// The validations of the trust policy verification levels.
+const (
+	notationCheckIntegrity          = "integrity"
+	notationCheckAuthenticity       = "authenticity"
+	notationCheckAuthenticTimestamp = "authenticTimestamp"
+	notationCheckExpiry             = "expiry"
+)
+
+// notationLevels maps the verification levels to the validations they
+// enforce, failures of the other validations are only logged.
+var notationLevels = map[string]map[string]bool{
+	"strict": {
+		notationCheckIntegrity:          true,
+		notationCheckAuthenticity:       true,
+		notationCheckAuthenticTimestamp: true,
+		notationCheckExpiry:             true,
+	},
+	"permissive": {
+		notationCheckIntegrity:    true,
+		notationCheckAuthenticity: true,
+	},
+	"audit": {
+		notationCheckIntegrity: true,
+	},
+}
+
+// notationCritical are the extended headers understood by the verifier, the
+// only ones a signature may mark critical. They have to be marked critical
+// when present.
+var notationCritical = map[string]bool{
+	notationSigningScheme: true,
+	notationAuthenticTime: true,
+	notationExpiry:        true,
+}
+
+// NotationTrust holds the trust store and trust policy used to verify Notary
+// Project signatures, as described in
+// https://github.com/notaryproject/specifications/blob/main/specs/trust-store-trust-policy.md
+//
+// The verification level of the policy decides which of the integrity,
+// authenticity, authentic timestamp and expiry checks fail verification and
+// which are only reported in the Warnings of the signature: strict enforces
+// all of them, permissive only integrity and authenticity, and audit only
+// integrity. Signatures aren't verified at the skip level. Revocation is not
+// checked and RFC 3161 timestamp countersignatures are not supported, so
+// signatures of the default scheme require certificates that are still valid
+// for the authentic timestamp check.
+type NotationTrust struct {
+	policies []notationPolicy
+	// stores maps "<type>:<name>" to the certificates of a named store
+	stores map[string][]*x509.Certificate
+}
+
+type notationPolicy struct {
+	Name                  string   `json:"name"`
+	RegistryScopes        []string `json:"registryScopes"`
+	SignatureVerification struct {
+		Level string `json:"level"`
+	} `json:"signatureVerification"`
+	TrustStores       []string `json:"trustStores"`
+	TrustedIdentities []string `json:"trustedIdentities"`
+}
+
+// LoadNotationTrust loads the trust policy file at policyPath, along with the
+// trust stores it refers to from the trust store directory storeDir. The
+// certificates of a store are read from "x509/<type>/<name>" in storeDir.
+func LoadNotationTrust(storeDir, policyPath string) (*NotationTrust, error) {
+	dt, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Version       string           `json:"version"`
+		TrustPolicies []notationPolicy `json:"trustPolicies"`
+	}
+	if err := json.Unmarshal(dt, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to decode trust policy")
+	}
+	if doc.Version != "1.0" {
+		return nil, errors.Errorf("unsupported trust policy version %q", doc.Version)
+	}
+
+	nt := &NotationTrust{
+		policies: doc.TrustPolicies,
+		stores:   map[string][]*x509.Certificate{},
+	}
+	for _, p := range nt.policies {
+		switch p.SignatureVerification.Level {
+		case "strict", "permissive", "audit":
+		case "skip":
+			continue
+		default:
+			return nil, errors.Errorf("invalid verification level %q in trust policy %s", p.SignatureVerification.Level, p.Name)
+		}
+		for _, store := range p.TrustStores {
+			if _, ok := nt.stores[store]; ok {
+				continue
+			}
+			typ, name, ok := strings.Cut(store, ":")
+			if !ok || name == "" || strings.ContainsAny(name, `/\`) {
+				return nil, errors.Errorf("invalid trust store %q in trust policy %s", store, p.Name)
+			}
+			certs, err := readCertificateDir(filepath.Join(storeDir, "x509", typ, name))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read trust store %s", store)
+			}
+			nt.stores[store] = certs
+		}
+	}
+	return nt, nil
+}
+
+func readCertificateDir(dir string) ([]*x509.Certificate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		dt, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if block, _ := pem.Decode(dt); block == nil {
+			cert, err := x509.ParseCertificate(dt)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", e.Name())
+			}
+			certs = append(certs, cert)
+			continue
+		}
+		c, err := parseCertificates(dt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", e.Name())
+		}
+		certs = append(certs, c...)
+	}
+	if len(certs) == 0 {
+		return nil, errors.Errorf("no certificates found in %s", dir)
+	}
+	return certs, nil
+}
+
+// policy returns the trust policy applying to the repository scope, which is
+// the one listing scope explicitly or otherwise the wildcard policy.
+func (nt *NotationTrust) policy(scope string) *notationPolicy {
+	var wildcard *notationPolicy
+	for i, p := range nt.policies {
+		for _, s := range p.RegistryScopes {
+			if s == scope {
+				return &nt.policies[i]
+			}
+			if s == "*" {
+				wildcard = &nt.policies[i]
+			}
+		}
+	}
+	return wildcard
+}
+
+// verify verifies the signature envelope against the policy for scope and
+// returns the identity of the signer along with the failures of the checks
+// the verification level only logs. It returns a nil identity without error
+// if the level skips verification.
+func (nt *NotationTrust) verify(scope string, env *notationEnvelope) (*Identity, []string, error) {
+	p := nt.policy(scope)
+	if p == nil {
+		return nil, nil, errors.Errorf("no trust policy applies to %s", scope)
+	}
+	enforced, ok := notationLevels[p.SignatureVerification.Level]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	var warnings []string
+	check := func(validation string, err error) error {
+		if err == nil || enforced[validation] {
+			return err
+		}
+		warnings = append(warnings, err.Error())
+		return nil
+	}
+
+	if len(env.certs) == 0 {
+		return nil, nil, errors.New("no signing certificate")
+	}
+	leaf := env.certs[0]
+	if err := check(notationCheckIntegrity, env.verifySignature(leaf.PublicKey)); err != nil {
+		return nil, nil, err
+	}
+
+	// only the signing authority scheme has an authentic signing time,
+	// otherwise the certificates must still be valid
+	storeType := "ca"
+	verifyTime := time.Now()
+	if env.signingScheme == notationSchemeX509Signing {
+		storeType = "signingAuthority"
+		verifyTime = env.signingTime
+	} else if env.signingScheme != notationSchemeX509 {
+		return nil, nil, errors.Errorf("unsupported signing scheme %q", env.signingScheme)
+	}
+
+	roots := x509.NewCertPool()
+	for _, store := range p.TrustStores {
+		if strings.HasPrefix(store, storeType+":") {
+			for _, c := range nt.stores[store] {
+				roots.AddCert(c)
+			}
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range env.certs[1:] {
+		intermediates.AddCert(c)
+	}
+	verifyChain := func(t time.Time) error {
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   t,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		})
+		return err
+	}
+
+	// an expired chain fails the authentic timestamp check, the chain is
+	// then verified within the validity of the signing certificate for the
+	// authenticity check
+	chainErr := verifyChain(verifyTime)
+	var certErr x509.CertificateInvalidError
+	if errors.As(chainErr, &certErr) && certErr.Reason == x509.Expired {
+		if err := check(notationCheckAuthenticTimestamp, errors.Wrap(chainErr, "certificate not valid at signing time")); err != nil {
+			return nil, nil, err
+		}
+		chainErr = verifyChain(leaf.NotBefore)
+	}
+	if chainErr != nil {
+		chainErr = errors.Wrap(chainErr, "failed to verify certificate chain")
+	} else if !trustedIdentity(p.TrustedIdentities, leaf) {
+		chainErr = errors.Errorf("%s is not a trusted identity", leaf.Subject)
+	}
+	if err := check(notationCheckAuthenticity, chainErr); err != nil {
+		return nil, nil, err
+	}
+
+	if !env.expiry.IsZero() && time.Now().After(env.expiry) {
+		if err := check(notationCheckExpiry, errors.Errorf("signature expired at %s", env.expiry)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &Identity{
+		Subject: leaf.Subject.String(),
+		Issuer:  leaf.Issuer.String(),
+	}, warnings, nil
+}
+
+// trustedIdentity reports whether the subject of cert matches one of the
+// "x509.subject: <DN>" identities. All attributes of the identity have to
+// match.
+func trustedIdentity(identities []string, cert *x509.Certificate) bool {
+	subject := map[string]string{}
+	for _, n := range cert.Subject.Names {
+		if key, ok := dnAttributes[n.Type.String()]; ok {
+			if v, ok := n.Value.(string); ok {
+				subject[key] = v
+			}
+		}
+	}
+
+	for _, id := range identities {
+		if id == "*" {
+			return true
+		}
+		if !strings.HasPrefix(id, "x509.subject:") {
+			continue
+		}
+		dn := strings.TrimPrefix(id, "x509.subject:")
+		match := true
+		for _, attr := range strings.Split(dn, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(attr), "=")
+			if !ok || subject[strings.ToUpper(strings.TrimSpace(k))] != strings.TrimSpace(v) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+var dnAttributes = map[string]string{
+	"2.5.4.3":  "CN",
+	"2.5.4.5":  "SERIALNUMBER",
+	"2.5.4.6":  "C",
+	"2.5.4.7":  "L",
+	"2.5.4.8":  "ST",
+	"2.5.4.10": "O",
+	"2.5.4.11": "OU",
+}
+
+// notationEnvelope is the signature envelope of a Notary Project signature,
+// decoded from either the JWS or the COSE format.
+type notationEnvelope struct {
+	payload       []byte
+	certs         []*x509.Certificate
+	signingScheme string
+	signingTime   time.Time
+	expiry        time.Time
+
+	alg string
+	// signed is the message covered by sig
+	signed []byte
+	sig    []byte
+
+	// cose is the message of COSE envelopes, verified with go-cose
+	cose *cose.Sign1Message
+}
+
+func (env *notationEnvelope) verifySignature(pub crypto.PublicKey) error {
+	if env.cose != nil {
+		alg, err := env.cose.Headers.Protected.Algorithm()
+		if err != nil {
+			return err
+		}
+		verifier, err := cose.NewVerifier(alg, pub)
+		if err != nil {
+			return err
+		}
+		return env.cose.Verify(nil, verifier)
+	}
+
+	var hash crypto.Hash
+	switch env.alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	h := hash.New()
+	h.Write(env.signed)
+	hashed := h.Sum(nil)
+
+	switch env.alg[:2] {
+	case "PS":
+		pub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.Errorf("%s signature with %T key", env.alg, pub)
+		}
+		return rsa.VerifyPSS(pub, hash, hashed, env.sig, nil)
+	case "ES":
+		pub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.Errorf("%s signature with %T key", env.alg, pub)
+		}
+		// JWS and COSE encode ECDSA signatures as r || s
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(env.sig) != 2*size {
+			return errors.New("invalid ecdsa signature length")
+		}
+		r := new(big.Int).SetBytes(env.sig[:size])
+		s := new(big.Int).SetBytes(env.sig[size:])
+		if !ecdsa.Verify(pub, hashed, r, s) {
+			return errors.New("invalid ecdsa signature")
+		}
+		return nil
+	}
+	return errors.Errorf("unsupported signature algorithm %s", env.alg)
+}
+
+func notationAlgorithm(alg string) (string, error) {
+	switch alg {
+	case "PS256", "PS384", "PS512", "ES256", "ES384", "ES512":
+		return alg, nil
+	}
+	return "", errors.Errorf("unsupported signature algorithm %q", alg)
+}
+
+func decodeJWS(dt []byte) (*notationEnvelope, error) {
+	var jws struct {
+		Payload   string `json:"payload"`
+		Protected string `json:"protected"`
+		Header    struct {
+			X5C [][]byte `json:"x5c"`
+		} `json:"header"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(dt, &jws); err != nil {
+		return nil, errors.Wrap(err, "unable to decode jws envelope")
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode jws protected header")
+	}
+	var headers struct {
+		Alg            string     `json:"alg"`
+		Cty            string     `json:"cty"`
+		SigningScheme  string     `json:"io.cncf.notary.signingScheme"`
+		SigningTime    *time.Time `json:"io.cncf.notary.signingTime"`
+		AuthenticTime  *time.Time `json:"io.cncf.notary.authenticSigningTime"`
+		Expiry         *time.Time `json:"io.cncf.notary.expiry"`
+		CriticalFields []string   `json:"crit"`
+	}
+	if err := json.Unmarshal(protected, &headers); err != nil {
+		return nil, errors.Wrap(err, "unable to decode jws protected header")
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(protected, &raw); err != nil {
+		return nil, errors.Wrap(err, "unable to decode jws protected header")
+	}
+	present := map[string]bool{}
+	for k := range raw {
+		present[k] = true
+	}
+	if err := checkCritical(headers.CriticalFields, present); err != nil {
+		return nil, err
+	}
+
+	env := &notationEnvelope{
+		signingScheme: headers.SigningScheme,
+		signed:        []byte(jws.Protected + "." + jws.Payload),
+	}
+	if env.alg, err = notationAlgorithm(headers.Alg); err != nil {
+		return nil, err
+	}
+	if headers.Cty != MediaTypeNotationPayload {
+		return nil, errors.Errorf("unsupported payload content type %q", headers.Cty)
+	}
+	if env.signingTime, err = signingTime(env.signingScheme, headers.AuthenticTime, headers.SigningTime); err != nil {
+		return nil, err
+	}
+	if headers.Expiry != nil {
+		env.expiry = *headers.Expiry
+	}
+	if env.payload, err = base64.RawURLEncoding.DecodeString(jws.Payload); err != nil {
+		return nil, errors.Wrap(err, "unable to decode jws payload")
+	}
+	if env.sig, err = base64.RawURLEncoding.DecodeString(jws.Signature); err != nil {
+		return nil, errors.Wrap(err, "unable to decode jws signature")
+	}
+	for _, der := range jws.Header.X5C {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse jws certificate chain")
+		}
+		env.certs = append(env.certs, cert)
+	}
+	return env, nil
+}
+
+func decodeCOSE(dt []byte) (*notationEnvelope, error) {
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(dt); err != nil {
+		return nil, errors.Wrap(err, "unable to decode cose envelope")
+	}
+	protected := msg.Headers.Protected
+
+	env := &notationEnvelope{
+		payload: msg.Payload,
+		cose:    &msg,
+	}
+
+	alg, err := protected.Algorithm()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cose protected header")
+	}
+	if env.alg, err = notationAlgorithm(alg.String()); err != nil {
+		return nil, err
+	}
+	if cty, _ := protected[cose.HeaderLabelContentType].(string); cty != MediaTypeNotationPayload {
+		return nil, errors.Errorf("unsupported payload content type %q", cty)
+	}
+	var crit []string
+	if v, ok := protected[cose.HeaderLabelCritical]; ok {
+		labels, _ := v.([]interface{})
+		for _, label := range labels {
+			h, ok := label.(string)
+			if !ok {
+				return nil, errors.Errorf("unsupported critical header %v", label)
+			}
+			crit = append(crit, h)
+		}
+	}
+	present := map[string]bool{}
+	for k := range protected {
+		if h, ok := k.(string); ok {
+			present[h] = true
+		}
+	}
+	if err := checkCritical(crit, present); err != nil {
+		return nil, err
+	}
+
+	env.signingScheme, _ = protected[notationSigningScheme].(string)
+	var authenticTime, signedAt *time.Time
+	if t, ok := protected[notationAuthenticTime].(time.Time); ok {
+		authenticTime = &t
+	}
+	if t, ok := protected[notationSigningTime].(time.Time); ok {
+		signedAt = &t
+	}
+	if env.signingTime, err = signingTime(env.signingScheme, authenticTime, signedAt); err != nil {
+		return nil, err
+	}
+	if t, ok := protected[notationExpiry].(time.Time); ok {
+		env.expiry = t
+	}
+
+	var chain []interface{}
+	switch x5c := msg.Headers.Unprotected[cose.HeaderLabelX5Chain].(type) {
+	case []byte:
+		chain = []interface{}{x5c}
+	case []interface{}:
+		chain = x5c
+	}
+	for _, item := range chain {
+		der, ok := item.([]byte)
+		if !ok {
+			return nil, errors.New("invalid cose certificate chain")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse cose certificate chain")
+		}
+		env.certs = append(env.certs, cert)
+	}
+	return env, nil
+}
+
+// checkCritical checks the critical headers crit of an envelope with the
+// protected headers present. Unknown critical headers are rejected, as
+// required for both JWS and COSE.
+func checkCritical(crit []string, present map[string]bool) error {
+	listed := map[string]bool{}
+	for _, h := range crit {
+		if !notationCritical[h] {
+			return errors.Errorf("unsupported critical header %q", h)
+		}
+		if !present[h] {
+			return errors.Errorf("critical header %q is missing", h)
+		}
+		listed[h] = true
+	}
+	for h := range notationCritical {
+		if present[h] && !listed[h] {
+			return errors.Errorf("header %q is not marked critical", h)
+		}
+	}
+	return nil
+}
+
+// signingTime returns the time the certificates are verified at for the
+// signing scheme. Only the signing authority scheme has an authentic signing
+// time, the signing time of the default scheme is informational.
+func signingTime(scheme string, authenticTime, signedAt *time.Time) (time.Time, error) {
+	if scheme == notationSchemeX509Signing {
+		if authenticTime == nil {
+			return time.Time{}, errors.Errorf("signing scheme %s requires an authentic signing time", scheme)
+		}
+		return *authenticTime, nil
+	}
+	if signedAt != nil {
+		return *signedAt, nil
+	}
+	return time.Time{}, nil
+}
+
+// isNotationSignature reports whether mfst is a Notary Project signature,
+// identified by its artifact type or, for registries without artifact type
+// support, its config media type.
+func isNotationSignature(mfst manifest) bool {
+	return mfst.artifactType == ArtifactTypeNotation || mfst.manifest.Config.MediaType == ArtifactTypeNotation
+}
+
+// scanNotation adds the Notary Project signatures referring to subject to
+// img. Signatures are verified with the trust policy for the repository scope
+// if a trust policy is configured.
+func (l *Loader) scanNotation(ctx context.Context, fetcher remotes.Fetcher, r *result, scope string, subject digest.Digest, img *Image) error {
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeJWS, "jws")
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, MediaTypeCOSE, "cose")
+
+	for _, dgst := range r.refs[subject] {
+		mfst, ok := r.manifests[dgst]
+		if !ok || !isNotationSignature(mfst) {
+			continue
+		}
+
+		for _, layer := range mfst.manifest.Layers {
+			if layer.MediaType != MediaTypeJWS && layer.MediaType != MediaTypeCOSE {
+				continue
+			}
+			sig, err := l.readNotationSignature(ctx, fetcher, layer, scope, subject)
+			if err != nil {
+				if err := l.recordError(&img.Errors, ComponentSignature, layer.Digest, err); err != nil {
+					return err
+				}
+				continue
+			}
+			img.Signatures = append(img.Signatures, *sig)
+		}
+	}
+	return nil
+}
+
+func (l *Loader) readNotationSignature(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor, scope string, subject digest.Digest) (*Signature, error) {
+	dt, err := l.readBlob(ctx, fetcher, layer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch signature %s", layer.Digest)
+	}
+
+	var env *notationEnvelope
+	if layer.MediaType == MediaTypeJWS {
+		env, err = decodeJWS(dt)
+	} else {
+		env, err = decodeCOSE(dt)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid signature %s", layer.Digest)
+	}
+
+	var payload struct {
+		TargetArtifact ocispec.Descriptor `json:"targetArtifact"`
+	}
+	if err := json.Unmarshal(env.payload, &payload); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode signature payload %s", layer.Digest)
+	}
+	if payload.TargetArtifact.Digest != subject {
+		return nil, errors.Errorf("signature %s is for %s, expected %s", layer.Digest, payload.TargetArtifact.Digest, subject)
+	}
+
+	s := &Signature{
+		Type:    SignatureTypeNotation,
+		Subject: subject,
+	}
+	if l.opt.NotationTrust != nil {
+		id, warnings, err := l.opt.NotationTrust.verify(scope, env)
+		if err != nil {
+			s.Error = err.Error()
+		} else if id != nil {
+			s.Verified = true
+			s.Identity = *id
+			s.Warnings = warnings
+		}
+	}
+	return s, nil
+}
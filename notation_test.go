@@ -0,0 +1,691 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-imageinspect/testutil"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+type testNotation struct {
+	t *testing.T
+
+	ca       *x509.Certificate
+	rsaLeaf  *x509.Certificate
+	rsaKey   *rsa.PrivateKey
+	ecLeaf   *x509.Certificate
+	ecKey    *ecdsa.PrivateKey
+	trustDir string
+
+	// expiredLeaf is a certificate for rsaKey that expired while the CA is
+	// still valid
+	expiredLeaf *x509.Certificate
+}
+
+func newTestNotation(t *testing.T) *testNotation {
+	n := &testNotation{t: t}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Country: []string{"US"}, Organization: []string{"acme"}, CommonName: "acme root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	dt, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	n.ca, err = x509.ParseCertificate(dt)
+	require.NoError(t, err)
+
+	leaf := func(serial int64, pub crypto.PublicKey, notBefore, notAfter time.Time) *x509.Certificate {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{Country: []string{"US"}, Organization: []string{"acme"}, CommonName: "signer"},
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}
+		dt, err := x509.CreateCertificate(rand.Reader, tmpl, n.ca, pub, caKey)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(dt)
+		require.NoError(t, err)
+		return cert
+	}
+
+	n.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	n.rsaLeaf = leaf(2, &n.rsaKey.PublicKey, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	n.expiredLeaf = leaf(4, &n.rsaKey.PublicKey, time.Now().Add(-50*time.Minute), time.Now().Add(-10*time.Minute))
+
+	n.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	n.ecLeaf = leaf(3, &n.ecKey.PublicKey, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+	n.trustDir = t.TempDir()
+	storeDir := filepath.Join(n.trustDir, "truststore", "x509", "ca", "acme")
+	require.NoError(t, os.MkdirAll(storeDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(storeDir, "root.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: n.ca.Raw}), 0644))
+
+	return n
+}
+
+func (n *testNotation) trust(identity string) *NotationTrust {
+	return n.trustLevel("strict", identity)
+}
+
+func (n *testNotation) trustLevel(level, identity string) *NotationTrust {
+	dt, err := json.Marshal(map[string]interface{}{
+		"version": "1.0",
+		"trustPolicies": []interface{}{
+			map[string]interface{}{
+				"name":                  "test",
+				"registryScopes":        []string{"docker.io/library/test"},
+				"signatureVerification": map[string]string{"level": level},
+				"trustStores":           []string{"ca:acme"},
+				"trustedIdentities":     []string{identity},
+			},
+			map[string]interface{}{
+				"name":                  "default",
+				"registryScopes":        []string{"*"},
+				"signatureVerification": map[string]string{"level": "skip"},
+			},
+		},
+	})
+	require.NoError(n.t, err)
+	p := filepath.Join(n.t.TempDir(), "trustpolicy.json")
+	require.NoError(n.t, os.WriteFile(p, dt, 0644))
+
+	nt, err := LoadNotationTrust(filepath.Join(n.trustDir, "truststore"), p)
+	require.NoError(n.t, err)
+	return nt
+}
+
+func (n *testNotation) payload(target ocispec.Descriptor) []byte {
+	dt, err := json.Marshal(map[string]interface{}{
+		"targetArtifact": target,
+	})
+	require.NoError(n.t, err)
+	return dt
+}
+
+func (n *testNotation) jws(target ocispec.Descriptor) []byte {
+	return n.signJWS(target, map[string]interface{}{
+		"alg":                          "PS256",
+		"cty":                          MediaTypeNotationPayload,
+		"crit":                         []string{"io.cncf.notary.signingScheme"},
+		"io.cncf.notary.signingScheme": "notary.x509",
+		"io.cncf.notary.signingTime":   time.Now().Format(time.RFC3339),
+	})
+}
+
+func (n *testNotation) signJWS(target ocispec.Descriptor, headers map[string]interface{}) []byte {
+	protected, err := json.Marshal(headers)
+	require.NoError(n.t, err)
+
+	p := base64.RawURLEncoding.EncodeToString(protected)
+	payload := base64.RawURLEncoding.EncodeToString(n.payload(target))
+
+	h := sha256.Sum256([]byte(p + "." + payload))
+	sig, err := rsa.SignPSS(rand.Reader, n.rsaKey, crypto.SHA256, h[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	require.NoError(n.t, err)
+
+	dt, err := json.Marshal(map[string]interface{}{
+		"payload":   payload,
+		"protected": p,
+		"header": map[string]interface{}{
+			"x5c":                         [][]byte{n.rsaLeaf.Raw, n.ca.Raw},
+			"io.cncf.notary.signingAgent": "test",
+		},
+		"signature": base64.RawURLEncoding.EncodeToString(sig),
+	})
+	require.NoError(n.t, err)
+	return dt
+}
+
+func (n *testNotation) cose(target ocispec.Descriptor) []byte {
+	return n.signCOSE(target, cose.ProtectedHeader{
+		cose.HeaderLabelAlgorithm:      cose.AlgorithmES256,
+		cose.HeaderLabelCritical:       []interface{}{"io.cncf.notary.signingScheme"},
+		cose.HeaderLabelContentType:    MediaTypeNotationPayload,
+		"io.cncf.notary.signingScheme": "notary.x509",
+		"io.cncf.notary.signingTime":   cbor.Tag{Number: 1, Content: time.Now().Unix()},
+	})
+}
+
+func (n *testNotation) signCOSE(target ocispec.Descriptor, protected cose.ProtectedHeader) []byte {
+	signer, err := cose.NewSigner(cose.AlgorithmES256, n.ecKey)
+	require.NoError(n.t, err)
+
+	dt, err := cose.Sign1(rand.Reader, signer, cose.Headers{
+		Protected: protected,
+		Unprotected: cose.UnprotectedHeader{
+			cose.HeaderLabelX5Chain:       []interface{}{n.ecLeaf.Raw, n.ca.Raw},
+			"io.cncf.notary.signingAgent": "test",
+		},
+	}, n.payload(target), nil)
+	require.NoError(n.t, err)
+	return dt
+}
+
+// notationImage adds a single platform image to env with a notation signature
+// referrer holding the envelope returned by sign.
+func notationImage(t *testing.T, env *testutil.Env, mediaType string, sign func(ocispec.Descriptor) []byte) *testutil.Blob {
+	cfg, err := testutil.Config(ocispec.Image{})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", mfst.Descriptor.Digest))
+
+	dt := sign(mfst.Descriptor)
+	sig := &testutil.Blob{
+		Data: dt,
+		Descriptor: ocispec.Descriptor{
+			MediaType: mediaType,
+			Digest:    digest.FromBytes(dt),
+			Size:      int64(len(dt)),
+		},
+	}
+	_, err = env.AddBlob(sig)
+	require.NoError(t, err)
+
+	dt, err = json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ocispec.MediaTypeImageManifest,
+		"artifactType":  "application/vnd.cncf.notary.signature",
+		"config": ocispec.Descriptor{
+			MediaType: "application/vnd.oci.empty.v1+json",
+			Digest:    digest.FromString("{}"),
+			Size:      2,
+		},
+		"layers":  []ocispec.Descriptor{sig.Descriptor},
+		"subject": mfst.Descriptor,
+	})
+	require.NoError(t, err)
+	artifact := &testutil.Blob{
+		Data: dt,
+		Descriptor: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Digest:    digest.FromBytes(dt),
+			Size:      int64(len(dt)),
+		},
+	}
+	_, err = env.AddBlob(artifact)
+	require.NoError(t, err)
+	env.AddReferrer(mfst.Descriptor.Digest, artifact.Descriptor)
+
+	return mfst
+}
+
+func TestNotation(t *testing.T) {
+	t.Parallel()
+
+	n := newTestNotation(t)
+
+	for _, tc := range []struct {
+		name      string
+		mediaType string
+		sign      func(ocispec.Descriptor) []byte
+		identity  string
+		verified  bool
+		err       string
+	}{
+		{name: "jws", mediaType: MediaTypeJWS, sign: n.jws, identity: "x509.subject: C=US, O=acme, CN=signer", verified: true},
+		{name: "cose", mediaType: MediaTypeCOSE, sign: n.cose, identity: "x509.subject: C=US, O=acme, CN=signer", verified: true},
+		{name: "wildcard identity", mediaType: MediaTypeJWS, sign: n.jws, identity: "*", verified: true},
+		{name: "untrusted identity", mediaType: MediaTypeCOSE, sign: n.cose, identity: "x509.subject: C=US, O=acme, CN=other", verified: false, err: "CN=signer,O=acme,C=US is not a trusted identity"},
+		{name: "no trust policy", mediaType: MediaTypeJWS, sign: n.jws, verified: false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			env := testutil.NewEnv(t)
+			env.SetReferrersAPI(true)
+
+			mfst := notationImage(t, env, tc.mediaType, tc.sign)
+
+			opt := Opt{
+				Resolver: env,
+			}
+			if tc.identity != "" {
+				opt.NotationTrust = n.trust(tc.identity)
+			}
+			l, err := NewLoader(opt)
+			require.NoError(t, err)
+
+			r, err := l.Load(ctx, "test")
+			require.NoError(t, err)
+
+			expected := Signature{
+				Type:     SignatureTypeNotation,
+				Subject:  mfst.Descriptor.Digest,
+				Verified: tc.verified,
+				Error:    tc.err,
+			}
+			if tc.verified {
+				expected.Identity = Identity{
+					Subject: "CN=signer,O=acme,C=US",
+					Issuer:  "CN=acme root,O=acme,C=US",
+				}
+			}
+			require.Equal(t, []Signature{expected}, r.Images["linux/amd64"].Signatures)
+		})
+	}
+}
+
+func TestNotationScope(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	n := newTestNotation(t)
+	env := testutil.NewEnv(t)
+	env.SetReferrersAPI(true)
+
+	mfst := notationImage(t, env, MediaTypeJWS, n.jws)
+	require.NoError(t, env.AddTag("docker.io/library/other:latest", mfst.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		Resolver:      env,
+		NotationTrust: n.trust("*"),
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+	require.True(t, r.Images["linux/amd64"].Signatures[0].Verified)
+
+	// the wildcard policy skips verification for other repositories
+	r, err = l.Load(ctx, "other")
+	require.NoError(t, err)
+	require.False(t, r.Images["linux/amd64"].Signatures[0].Verified)
+}
+
+func TestNotationLevels(t *testing.T) {
+	t.Parallel()
+
+	n := newTestNotation(t)
+	target := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString("test"),
+		Size:      4,
+	}
+
+	expired := n.signJWS(target, map[string]interface{}{
+		"alg":                          "PS256",
+		"cty":                          MediaTypeNotationPayload,
+		"crit":                         []string{"io.cncf.notary.signingScheme", "io.cncf.notary.expiry"},
+		"io.cncf.notary.signingScheme": "notary.x509",
+		"io.cncf.notary.signingTime":   time.Now().Add(-time.Hour).Format(time.RFC3339),
+		"io.cncf.notary.expiry":        time.Now().Add(-time.Minute).Format(time.RFC3339),
+	})
+	expiredCert := *n
+	expiredCert.rsaLeaf = n.expiredLeaf
+	expiredChain := expiredCert.jws(target)
+	tampered := bytes.Replace(n.jws(target), []byte(`"signature":"`), []byte(`"signature":"A`), 1)
+
+	const trusted = "x509.subject: C=US, O=acme, CN=signer"
+	const untrusted = "x509.subject: C=US, O=acme, CN=other"
+
+	for _, tc := range []struct {
+		name     string
+		level    string
+		envelope []byte
+		identity string
+		verified bool
+		warning  string
+		err      string
+	}{
+		{name: "strict expired signature", level: "strict", envelope: expired, identity: trusted, err: "signature expired"},
+		{name: "permissive expired signature", level: "permissive", envelope: expired, identity: trusted, verified: true, warning: "signature expired"},
+		{name: "strict expired certificate", level: "strict", envelope: expiredChain, identity: trusted, err: "certificate not valid at signing time"},
+		{name: "permissive expired certificate", level: "permissive", envelope: expiredChain, identity: trusted, verified: true, warning: "certificate not valid at signing time"},
+		{name: "permissive untrusted identity", level: "permissive", envelope: n.jws(target), identity: untrusted, err: "is not a trusted identity"},
+		{name: "audit untrusted identity", level: "audit", envelope: n.jws(target), identity: untrusted, verified: true, warning: "is not a trusted identity"},
+		{name: "audit tampered", level: "audit", envelope: tampered, identity: trusted, err: "verification error"},
+		{name: "skip tampered", level: "skip", envelope: tampered, identity: trusted},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			env, err := decodeJWS(tc.envelope)
+			require.NoError(t, err)
+
+			id, warnings, err := n.trustLevel(tc.level, tc.identity).verify("docker.io/library/test", env)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.verified, id != nil)
+			if tc.warning == "" {
+				require.Empty(t, warnings)
+			} else {
+				require.Equal(t, 1, len(warnings))
+				require.Contains(t, warnings[0], tc.warning)
+			}
+		})
+	}
+}
+
+func TestNotationCOSEDuplicateKey(t *testing.T) {
+	t.Parallel()
+
+	// protected header {1: -7, 1: -7}
+	protected := []byte{0xa2, 0x01, 0x26, 0x01, 0x26}
+	dt, err := cbor.Marshal(cbor.Tag{Number: 18, Content: []interface{}{
+		protected,
+		map[interface{}]interface{}{},
+		[]byte("{}"),
+		[]byte{1},
+	}})
+	require.NoError(t, err)
+
+	_, err = decodeCOSE(dt)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "duplicate map key")
+}
+
+func TestNotationCritical(t *testing.T) {
+	t.Parallel()
+
+	n := newTestNotation(t)
+	target := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString("test"),
+		Size:      4,
+	}
+	signedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	for _, tc := range []struct {
+		name    string
+		scheme  string
+		crit    []string
+		headers map[string]time.Time
+		err     string
+		// go-cose already refuses to encode or decode the envelope
+		jwsOnly bool
+	}{
+		{
+			name:   "valid",
+			scheme: "notary.x509",
+			crit:   []string{"io.cncf.notary.signingScheme"},
+		},
+		{
+			name:   "unknown critical header",
+			scheme: "notary.x509",
+			crit:   []string{"io.cncf.notary.signingScheme", "io.cncf.notary.signingTime"},
+			err:    `unsupported critical header "io.cncf.notary.signingTime"`,
+		},
+		{
+			name:    "missing critical header",
+			scheme:  "notary.x509",
+			crit:    []string{"io.cncf.notary.signingScheme", "io.cncf.notary.expiry"},
+			err:     `critical header "io.cncf.notary.expiry" is missing`,
+			jwsOnly: true,
+		},
+		{
+			name:   "signing scheme not critical",
+			scheme: "notary.x509",
+			err:    `header "io.cncf.notary.signingScheme" is not marked critical`,
+		},
+		{
+			name:   "signing authority",
+			scheme: "notary.x509.signingAuthority",
+			crit:   []string{"io.cncf.notary.signingScheme", "io.cncf.notary.authenticSigningTime"},
+			headers: map[string]time.Time{
+				"io.cncf.notary.authenticSigningTime": signedAt,
+			},
+		},
+		{
+			name:   "signing authority without authentic signing time",
+			scheme: "notary.x509.signingAuthority",
+			crit:   []string{"io.cncf.notary.signingScheme"},
+			err:    "signing scheme notary.x509.signingAuthority requires an authentic signing time",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			jwsHeaders := map[string]interface{}{
+				"alg":                          "PS256",
+				"cty":                          MediaTypeNotationPayload,
+				"io.cncf.notary.signingScheme": tc.scheme,
+				"io.cncf.notary.signingTime":   signedAt.Add(time.Hour).Format(time.RFC3339),
+			}
+			coseHeaders := cose.ProtectedHeader{
+				cose.HeaderLabelAlgorithm:      cose.AlgorithmES256,
+				cose.HeaderLabelContentType:    MediaTypeNotationPayload,
+				"io.cncf.notary.signingScheme": tc.scheme,
+				"io.cncf.notary.signingTime":   cbor.Tag{Number: 1, Content: signedAt.Add(time.Hour).Unix()},
+			}
+			if tc.crit != nil {
+				jwsHeaders["crit"] = tc.crit
+				var crit []interface{}
+				for _, h := range tc.crit {
+					crit = append(crit, h)
+				}
+				coseHeaders[cose.HeaderLabelCritical] = crit
+			}
+			for k, v := range tc.headers {
+				jwsHeaders[k] = v.Format(time.RFC3339)
+				coseHeaders[k] = cbor.Tag{Number: 1, Content: v.Unix()}
+			}
+
+			for name, decode := range map[string]func() (*notationEnvelope, error){
+				"jws": func() (*notationEnvelope, error) {
+					return decodeJWS(n.signJWS(target, jwsHeaders))
+				},
+				"cose": func() (*notationEnvelope, error) {
+					return decodeCOSE(n.signCOSE(target, coseHeaders))
+				},
+			} {
+				if name == "cose" && tc.jwsOnly {
+					continue
+				}
+				env, err := decode()
+				if tc.err != "" {
+					require.EqualError(t, err, tc.err, name)
+					continue
+				}
+				require.NoError(t, err, name)
+				if tc.scheme == notationSchemeX509Signing {
+					require.True(t, signedAt.Equal(env.signingTime), name)
+				}
+			}
+		})
+	}
+}
+
+// TestNotationConformance verifies JWS and COSE envelopes from the
+// notation-go test vectors.
+func TestNotationConformance(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testRoot = "CN=Notation Test Root,O=Notary,L=Seattle,ST=WA,C=US"
+		alpine   = "CN=alpine,O=Notary,L=Seattle,ST=WA,C=US"
+	)
+
+	dir := t.TempDir()
+	for _, typ := range []string{"ca", "signingAuthority"} {
+		storeDir := filepath.Join(dir, "truststore", "x509", typ, "test")
+		require.NoError(t, os.MkdirAll(storeDir, 0755))
+		for _, name := range []string{"NotationTestRoot.pem", "TestTimestamp.crt"} {
+			dt, err := os.ReadFile(filepath.Join("testdata", "notation", name))
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(filepath.Join(storeDir, name), dt, 0644))
+		}
+	}
+	dt, err := json.Marshal(map[string]interface{}{
+		"version": "1.0",
+		"trustPolicies": []interface{}{
+			map[string]interface{}{
+				"name":                  "test",
+				"registryScopes":        []string{"*"},
+				"signatureVerification": map[string]string{"level": "strict"},
+				"trustStores":           []string{"ca:test", "signingAuthority:test"},
+				"trustedIdentities": []string{
+					"x509.subject: C=US, ST=WA, L=Seattle, O=Notary, CN=Notation Test Root",
+					"x509.subject: C=US, ST=WA, L=Seattle, O=Notary, CN=alpine",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	policy := filepath.Join(dir, "trustpolicy.json")
+	require.NoError(t, os.WriteFile(policy, dt, 0644))
+	nt, err := LoadNotationTrust(filepath.Join(dir, "truststore"), policy)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name    string
+		file    string
+		target  digest.Digest
+		subject string
+		tamper  func([]byte) []byte
+		err     string
+	}{
+		{
+			name:    "jws",
+			file:    "ca_valid_sig_env.json",
+			target:  "sha256:60043cf45eaebc4c0867fea485a039b598f52fd09fd5b07b0b2d2f88fad9d74e",
+			subject: testRoot,
+		},
+		{
+			name:    "jws signing authority",
+			file:    "sa_valid_sig_env.json",
+			target:  "sha256:60043cf45eaebc4c0867fea485a039b598f52fd09fd5b07b0b2d2f88fad9d74e",
+			subject: testRoot,
+		},
+		{
+			name:    "jws with timestamp",
+			file:    "jwsWithTimestamp.sig",
+			target:  "sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda",
+			subject: alpine,
+		},
+		{
+			name:    "cose with timestamp",
+			file:    "coseWithTimestamp.sig",
+			target:  "sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda",
+			subject: alpine,
+		},
+		{
+			name: "tampered cose",
+			file: "coseWithTimestamp.sig",
+			tamper: func(dt []byte) []byte {
+				return bytes.Replace(dt, []byte("sha256:c0669ef3"), []byte("sha256:c0669ef4"), 1)
+			},
+			err: "verification error",
+		},
+		{
+			name: "tampered jws",
+			file: "ca_valid_sig_env.json",
+			tamper: func(dt []byte) []byte {
+				var env map[string]interface{}
+				require.NoError(t, json.Unmarshal(dt, &env))
+				payload, err := base64.RawURLEncoding.DecodeString(env["payload"].(string))
+				require.NoError(t, err)
+				env["payload"] = base64.RawURLEncoding.EncodeToString(bytes.Replace(payload, []byte(`"size":528`), []byte(`"size":529`), 1))
+				dt, err = json.Marshal(env)
+				require.NoError(t, err)
+				return dt
+			},
+			err: "verification error",
+		},
+		{name: "invalid payload encoding", file: "ca_invalid_sig_env.json", err: "unable to decode jws payload"},
+		{name: "expired", file: "ca_expired_sig_env.json", err: "signature expired"},
+		{name: "signing authority expired", file: "sa_expired_sig_env.json", err: "signature expired"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dt, err := os.ReadFile(filepath.Join("testdata", "notation", tc.file))
+			require.NoError(t, err)
+			if tc.tamper != nil {
+				tampered := tc.tamper(dt)
+				require.NotEqual(t, dt, tampered)
+				dt = tampered
+			}
+
+			var env *notationEnvelope
+			if strings.HasPrefix(tc.file, "cose") {
+				env, err = decodeCOSE(dt)
+			} else {
+				env, err = decodeJWS(dt)
+			}
+			var id *Identity
+			var warnings []string
+			if err == nil {
+				id, warnings, err = nt.verify("docker.io/library/test", env)
+			}
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Empty(t, warnings)
+			require.Equal(t, tc.subject, id.Subject)
+
+			var payload struct {
+				TargetArtifact ocispec.Descriptor `json:"targetArtifact"`
+			}
+			require.NoError(t, json.Unmarshal(env.payload, &payload))
+			require.Equal(t, tc.target, payload.TargetArtifact.Digest)
+		})
+	}
+}
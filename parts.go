@@ -0,0 +1,82 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Part is a set of the parts of the image metadata to load.
+type Part uint
+
+const (
+	// PartConfig loads the title, description and other metadata from the
+	// image config labels and manifest annotations.
+	PartConfig Part = 1 << iota
+	// PartLayers loads the image layers and history.
+	PartLayers
+	// PartSBOM loads the SBOM attestations.
+	PartSBOM
+	// PartProvenance loads the provenance attestations and buildinfo.
+	PartProvenance
+	// PartSignatures loads the image signatures.
+	PartSignatures
+
+	PartAll = PartConfig | PartLayers | PartSBOM | PartProvenance | PartSignatures
+)
+
+var partNames = map[string]Part{
+	"config":     PartConfig,
+	"layers":     PartLayers,
+	"sbom":       PartSBOM,
+	"provenance": PartProvenance,
+	"signatures": PartSignatures,
+	"all":        PartAll,
+}
+
+// ParseParts parses a comma separated list of part names, such as
+// "config,sbom".
+func ParseParts(s string) (Part, error) {
+	var parts Part
+	for _, name := range strings.Split(s, ",") {
+		p, ok := partNames[strings.TrimSpace(name)]
+		if !ok {
+			return 0, errors.Errorf("unknown part %q", name)
+		}
+		parts |= p
+	}
+	return parts, nil
+}
+
+// want reports whether any of parts should be loaded.
+func (l *Loader) want(parts Part) bool {
+	if l.opt.Parts == 0 {
+		return true
+	}
+	return l.opt.Parts&parts != 0
+}
+
+// wantPredicate reports whether statements of predicateType should be loaded.
+func (l *Loader) wantPredicate(predicateType string) bool {
+	switch predicateType {
+	case PredicateSPDX, PredicateCycloneDX:
+		return l.want(PartSBOM)
+	case PredicateSLSAProvenanceV02, PredicateSLSAProvenanceV1:
+		return l.want(PartProvenance)
+	}
+	return false
+}
@@ -14,11 +14,38 @@
 
 package imageinspect
 
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
 type Provenance struct { // TODO: this is only a stub, to be refactored later
+	// SLSAVersion is the version of the SLSA provenance predicate the
+	// provenance was read from ("v0.2" or "v1"). It is empty for provenance
+	// read from legacy BuildKit buildinfo.
+	SLSAVersion     string            `json:",omitempty"`
+	BuilderID       string            `json:",omitempty"`
 	BuildSource     string            `json:",omitempty"`
 	BuildDefinition string            `json:",omitempty"`
 	BuildParameters map[string]string `json:",omitempty"`
+	BuildStartedOn  *time.Time        `json:",omitempty"`
+	BuildFinishedOn *time.Time        `json:",omitempty"`
 	Materials       []Material
+
+	// Signatures are the signatures of the attestation the provenance was
+	// read from. It is empty if the attestation was not signed.
+	Signatures []Signature `json:",omitempty"`
+
+	// predicate is the digest of the compacted SLSA predicate the
+	// provenance was read from.
+	predicate digest.Digest
 }
 
 type Material struct {
@@ -27,3 +54,254 @@ type Material struct {
 	Alias string `json:",omitempty"`
 	Pin   string `json:",omitempty"`
 }
+
+type slsa02Predicate struct {
+	slsa02.ProvenancePredicate
+	Invocation slsa02Invocation `json:"invocation,omitempty"`
+}
+
+type slsa02Invocation struct {
+	ConfigSource slsa02.ConfigSource `json:"configSource,omitempty"`
+	Parameters   json.RawMessage     `json:"parameters,omitempty"`
+}
+
+type slsa1Predicate struct {
+	BuildDefinition slsa1BuildDefinition `json:"buildDefinition"`
+	RunDetails      slsa1RunDetails      `json:"runDetails"`
+}
+
+type slsa1BuildDefinition struct {
+	BuildType            string                    `json:"buildType"`
+	ExternalParameters   json.RawMessage           `json:"externalParameters,omitempty"`
+	InternalParameters   json.RawMessage           `json:"internalParameters,omitempty"`
+	ResolvedDependencies []slsa1ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+type slsa1ResourceDescriptor struct {
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+	Name   string            `json:"name,omitempty"`
+}
+
+type slsa1RunDetails struct {
+	Builder  slsa1Builder        `json:"builder"`
+	Metadata *slsa1BuildMetadata `json:"metadata,omitempty"`
+}
+
+type slsa1Builder struct {
+	ID string `json:"id"`
+}
+
+type slsa1BuildMetadata struct {
+	InvocationID string     `json:"invocationID,omitempty"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+// buildkitParameters is the shape of the invocation parameters written by
+// BuildKit.
+type buildkitParameters struct {
+	Frontend string            `json:"frontend,omitempty"`
+	Args     map[string]string `json:"args,omitempty"`
+}
+
+// buildkitExternalParameters is the shape of the SLSA v1 external parameters
+// written by BuildKit.
+type buildkitExternalParameters struct {
+	ConfigSource struct {
+		URI  string `json:"uri,omitempty"`
+		Path string `json:"path,omitempty"`
+	} `json:"configSource,omitempty"`
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+// addProvenanceStatement sets the provenance of img from the SLSA predicate of
+// stmt. When the same predicate was already read from another attestation,
+// sigs are added to its signatures. Otherwise the provenance is only replaced
+// by a statement with a higher signatureRank, so the result doesn't depend on
+// the order attestations are read in.
+func addProvenanceStatement(img *Image, stmt *inTotoStatement, sigs []Signature) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, stmt.Predicate); err != nil {
+		return errors.Wrap(err, "unable to decode slsa provenance")
+	}
+	predicate := digest.FromBytes(buf.Bytes())
+
+	if prev := img.Provenance; prev != nil {
+		if prev.predicate == predicate {
+			prev.Signatures = append(prev.Signatures, sigs...)
+			return nil
+		}
+		if signatureRank(sigs) <= signatureRank(prev.Signatures) {
+			return nil
+		}
+	}
+
+	add := addSLSAProvenanceV02
+	if stmt.PredicateType == PredicateSLSAProvenanceV1 {
+		add = addSLSAProvenanceV1
+	}
+	if err := add(img, stmt.Predicate); err != nil {
+		return err
+	}
+	img.Provenance.predicate = predicate
+	img.Provenance.Signatures = sigs
+	return nil
+}
+
+// signatureRank ranks verified signatures above signatures that could not be
+// verified, and those above none.
+func signatureRank(sigs []Signature) int {
+	for _, s := range sigs {
+		if s.Verified {
+			return 2
+		}
+	}
+	if len(sigs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func addSLSAProvenanceV02(img *Image, dt []byte) error {
+	var pred slsa02Predicate
+	if err := json.Unmarshal(dt, &pred); err != nil {
+		return errors.Wrap(err, "unable to decode slsa provenance")
+	}
+
+	p := &Provenance{
+		SLSAVersion:     "v0.2",
+		BuilderID:       pred.Builder.ID,
+		BuildSource:     pred.Invocation.ConfigSource.URI,
+		BuildDefinition: pred.Invocation.ConfigSource.EntryPoint,
+		BuildParameters: decodeBuildParameters(pred.Invocation.Parameters),
+		Materials:       make([]Material, len(pred.Materials)),
+	}
+
+	if md := pred.Metadata; md != nil {
+		p.BuildStartedOn = md.BuildStartedOn
+		p.BuildFinishedOn = md.BuildFinishedOn
+	}
+
+	for i, m := range pred.Materials {
+		p.Materials[i] = Material{
+			Type: materialType(m.URI),
+			Ref:  m.URI,
+			Pin:  pinFromDigestSet(m.Digest),
+		}
+	}
+
+	img.Provenance = p
+	return nil
+}
+
+func addSLSAProvenanceV1(img *Image, dt []byte) error {
+	var pred slsa1Predicate
+	if err := json.Unmarshal(dt, &pred); err != nil {
+		return errors.Wrap(err, "unable to decode slsa provenance")
+	}
+
+	deps := pred.BuildDefinition.ResolvedDependencies
+	p := &Provenance{
+		SLSAVersion: "v1",
+		BuilderID:   pred.RunDetails.Builder.ID,
+		Materials:   make([]Material, len(deps)),
+	}
+
+	var ext buildkitExternalParameters
+	if err := json.Unmarshal(pred.BuildDefinition.ExternalParameters, &ext); err == nil && len(ext.Request) > 0 {
+		p.BuildSource = ext.ConfigSource.URI
+		p.BuildDefinition = ext.ConfigSource.Path
+		p.BuildParameters = decodeBuildParameters(ext.Request)
+	} else {
+		p.BuildParameters = decodeBuildParameters(pred.BuildDefinition.ExternalParameters)
+	}
+
+	if md := pred.RunDetails.Metadata; md != nil {
+		p.BuildStartedOn = md.StartedOn
+		p.BuildFinishedOn = md.FinishedOn
+	}
+
+	for i, d := range deps {
+		p.Materials[i] = Material{
+			Type:  materialType(d.URI),
+			Ref:   d.URI,
+			Alias: d.Name,
+			Pin:   pinFromDigestSet(d.Digest),
+		}
+	}
+
+	img.Provenance = p
+	return nil
+}
+
+// decodeBuildParameters returns the build arguments from BuildKit invocation
+// parameters, or the top-level string parameters for other builders.
+func decodeBuildParameters(dt json.RawMessage) map[string]string {
+	if len(dt) == 0 {
+		return nil
+	}
+
+	var bp buildkitParameters
+	if err := json.Unmarshal(dt, &bp); err == nil && bp.Frontend != "" {
+		var params map[string]string
+		for key, val := range bp.Args {
+			if !strings.HasPrefix(key, "build-arg:") {
+				continue
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[strings.TrimPrefix(key, "build-arg:")] = val
+		}
+		return params
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(dt, &m); err != nil {
+		return nil
+	}
+	var params map[string]string
+	for key, val := range m {
+		s, ok := val.(string)
+		if !ok {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[key] = s
+	}
+	return params
+}
+
+// materialType maps a material URI to the source types used by BuildKit
+// buildinfo.
+func materialType(uri string) string {
+	switch {
+	case strings.HasPrefix(uri, "pkg:docker/"), strings.HasPrefix(uri, "pkg:oci/"):
+		return "docker-image"
+	case strings.HasPrefix(uri, "git+"), strings.HasPrefix(uri, "git://"), strings.HasSuffix(strings.SplitN(uri, "#", 2)[0], ".git"):
+		return "git"
+	case strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "http://"):
+		return "http"
+	}
+	return ""
+}
+
+// pinFromDigestSet formats the preferred digest of the set as
+// "algorithm:hex", using sha256 if available.
+func pinFromDigestSet(ds map[string]string) string {
+	if v, ok := ds["sha256"]; ok {
+		return "sha256:" + v
+	}
+	algs := make([]string, 0, len(ds))
+	for alg := range ds {
+		algs = append(algs, alg)
+	}
+	if len(algs) == 0 {
+		return ""
+	}
+	sort.Strings(algs)
+	return algs[0] + ":" + ds[algs[0]]
+}
@@ -0,0 +1,285 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/docker/go-imageinspect/testutil"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenanceAttestation(t *testing.T) {
+	t.Parallel()
+
+	env := testutil.NewEnv(t)
+
+	bi, err := json.Marshal(map[string]interface{}{
+		"attrs": map[string]string{
+			"context": "https://github.com/docker/buildinfo.git",
+		},
+	})
+	require.NoError(t, err)
+
+	dt, err := json.Marshal(map[string]interface{}{
+		"architecture":               "amd64",
+		"os":                         "linux",
+		"moby.buildkit.buildinfo.v1": base64.StdEncoding.EncodeToString(bi),
+	})
+	require.NoError(t, err)
+	cfg := &testutil.Blob{
+		Data: dt,
+		Descriptor: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(dt),
+			Size:      int64(len(dt)),
+		},
+	}
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	img := loadProvenance(t, env, cfg, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+		"builder":   map[string]string{"id": "https://github.com/docker/go-imageinspect/actions/runs/1"},
+		"buildType": "https://mobyproject.org/buildkit@v1",
+		"invocation": map[string]interface{}{
+			"configSource": map[string]interface{}{
+				"uri":        "https://github.com/docker/go-imageinspect.git#main",
+				"entryPoint": "Dockerfile",
+			},
+			"parameters": map[string]interface{}{
+				"frontend": "dockerfile.v0",
+				"args": map[string]string{
+					"build-arg:FOO": "bar",
+					"label:baz":     "qux",
+				},
+			},
+		},
+		"metadata": map[string]interface{}{
+			"buildStartedOn":  "2022-11-22T10:00:00Z",
+			"buildFinishedOn": "2022-11-22T10:05:00Z",
+		},
+		"materials": []interface{}{
+			map[string]interface{}{
+				"uri":    "pkg:docker/alpine@3.16?platform=linux%2Famd64",
+				"digest": map[string]string{"sha256": "e2e16842c9b54d985bf1ef9242a313f36b856181f188de21313820e177002501"},
+			},
+			map[string]interface{}{
+				"uri":    "https://github.com/docker/go-imageinspect.git#main",
+				"digest": map[string]string{"sha1": "2aa1b3f1d5e3b2e1fdfa00bf7de8bf2c5e8e0e2d"},
+			},
+		},
+	})
+
+	p := img.Provenance
+	require.NotNil(t, p)
+
+	require.Equal(t, "v0.2", p.SLSAVersion)
+	require.Equal(t, "https://github.com/docker/go-imageinspect/actions/runs/1", p.BuilderID)
+	require.Equal(t, "https://github.com/docker/go-imageinspect.git#main", p.BuildSource)
+	require.Equal(t, "Dockerfile", p.BuildDefinition)
+	require.Equal(t, map[string]string{"FOO": "bar"}, p.BuildParameters)
+	require.NotNil(t, p.BuildStartedOn)
+	require.True(t, p.BuildStartedOn.Equal(time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)))
+	require.NotNil(t, p.BuildFinishedOn)
+	require.True(t, p.BuildFinishedOn.Equal(time.Date(2022, 11, 22, 10, 5, 0, 0, time.UTC)))
+
+	require.Equal(t, []Material{
+		{
+			Type: "docker-image",
+			Ref:  "pkg:docker/alpine@3.16?platform=linux%2Famd64",
+			Pin:  "sha256:e2e16842c9b54d985bf1ef9242a313f36b856181f188de21313820e177002501",
+		},
+		{
+			Type: "git",
+			Ref:  "https://github.com/docker/go-imageinspect.git#main",
+			Pin:  "sha1:2aa1b3f1d5e3b2e1fdfa00bf7de8bf2c5e8e0e2d",
+		},
+	}, p.Materials)
+}
+
+func TestProvenanceAttestationV1(t *testing.T) {
+	t.Parallel()
+
+	env := testutil.NewEnv(t)
+
+	cfg, err := testutil.Config(ocispec.Image{})
+	require.NoError(t, err)
+	_, err = env.AddBlob(cfg)
+	require.NoError(t, err)
+
+	img := loadProvenance(t, env, cfg, "https://slsa.dev/provenance/v1", map[string]interface{}{
+		"buildDefinition": map[string]interface{}{
+			"buildType": "https://mobyproject.org/buildkit@v1",
+			"externalParameters": map[string]interface{}{
+				"configSource": map[string]interface{}{
+					"uri":  "https://github.com/docker/go-imageinspect.git#main",
+					"path": "Dockerfile",
+				},
+				"request": map[string]interface{}{
+					"frontend": "dockerfile.v0",
+					"args": map[string]string{
+						"build-arg:FOO": "bar",
+					},
+				},
+			},
+			"resolvedDependencies": []interface{}{
+				map[string]interface{}{
+					"uri":    "pkg:docker/alpine@3.16?platform=linux%2Famd64",
+					"digest": map[string]string{"sha256": "e2e16842c9b54d985bf1ef9242a313f36b856181f188de21313820e177002501"},
+				},
+			},
+		},
+		"runDetails": map[string]interface{}{
+			"builder": map[string]string{"id": "https://github.com/docker/go-imageinspect/actions/runs/1"},
+			"metadata": map[string]interface{}{
+				"invocationID": "abc",
+				"startedOn":    "2022-11-22T10:00:00Z",
+				"finishedOn":   "2022-11-22T10:05:00Z",
+			},
+		},
+	})
+
+	p := img.Provenance
+	require.NotNil(t, p)
+
+	require.Equal(t, "v1", p.SLSAVersion)
+	require.Equal(t, "https://github.com/docker/go-imageinspect/actions/runs/1", p.BuilderID)
+	require.Equal(t, "https://github.com/docker/go-imageinspect.git#main", p.BuildSource)
+	require.Equal(t, "Dockerfile", p.BuildDefinition)
+	require.Equal(t, map[string]string{"FOO": "bar"}, p.BuildParameters)
+	require.NotNil(t, p.BuildStartedOn)
+	require.True(t, p.BuildStartedOn.Equal(time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)))
+	require.NotNil(t, p.BuildFinishedOn)
+	require.True(t, p.BuildFinishedOn.Equal(time.Date(2022, 11, 22, 10, 5, 0, 0, time.UTC)))
+
+	require.Equal(t, []Material{
+		{
+			Type: "docker-image",
+			Ref:  "pkg:docker/alpine@3.16?platform=linux%2Famd64",
+			Pin:  "sha256:e2e16842c9b54d985bf1ef9242a313f36b856181f188de21313820e177002501",
+		},
+	}, p.Materials)
+}
+
+func loadProvenance(t *testing.T, env *testutil.Env, cfg *testutil.Blob, predicateType string, predicate interface{}) Image {
+	ctx := context.Background()
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(mfst)
+	require.NoError(t, err)
+
+	stmt, err := testutil.Statement(mfst.Descriptor, predicateType, predicate)
+	require.NoError(t, err)
+	_, err = env.AddBlob(stmt)
+	require.NoError(t, err)
+
+	att, err := testutil.AttestationManifest(mfst.Descriptor, stmt.Descriptor)
+	require.NoError(t, err)
+	_, err = env.AddBlob(att)
+	require.NoError(t, err)
+
+	idx, err := testutil.Index(ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			mfst.Descriptor,
+			att.Descriptor,
+		},
+	})
+	require.NoError(t, err)
+	_, err = env.AddBlob(idx)
+	require.NoError(t, err)
+
+	require.NoError(t, env.AddTag("docker.io/library/test:latest", idx.Descriptor.Digest))
+
+	l, err := NewLoader(Opt{
+		CacheDir: t.TempDir(),
+		Resolver: env,
+	})
+	require.NoError(t, err)
+
+	r, err := l.Load(ctx, "test")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"linux/amd64"}, r.Platforms)
+
+	img, ok := r.Images["linux/amd64"]
+	require.True(t, ok)
+
+	return img
+}
+
+func TestProvenanceSignatures(t *testing.T) {
+	t.Parallel()
+
+	stmt := func(pred string) *inTotoStatement {
+		s := &inTotoStatement{Predicate: json.RawMessage(pred)}
+		s.PredicateType = PredicateSLSAProvenanceV02
+		return s
+	}
+	predA := `{"builder": {"id": "https://example.com/a"}}`
+	predB := `{"builder": {"id": "https://example.com/b"}}`
+	sigA := Signature{Type: SignatureTypeDSSE, Verified: true, Identity: Identity{KeyID: "a"}}
+	sigB := Signature{Type: SignatureTypeCosign, Verified: true, Identity: Identity{KeyID: "b"}}
+
+	var img Image
+	require.NoError(t, addProvenanceStatement(&img, stmt(predA), []Signature{sigA}))
+	require.Equal(t, []Signature{sigA}, img.Provenance.Signatures)
+
+	// the unsigned copy of the same statement does not drop its signatures
+	require.NoError(t, addProvenanceStatement(&img, stmt(`{"builder":{"id":"https://example.com/a"}}`), nil))
+	require.Equal(t, []Signature{sigA}, img.Provenance.Signatures)
+
+	// signatures of the same statement from another attestation are merged
+	require.NoError(t, addProvenanceStatement(&img, stmt(predA), []Signature{sigB}))
+	require.Equal(t, []Signature{sigA, sigB}, img.Provenance.Signatures)
+
+	// an unsigned statement does not replace signed provenance
+	require.NoError(t, addProvenanceStatement(&img, stmt(predB), nil))
+	require.Equal(t, "https://example.com/a", img.Provenance.BuilderID)
+	require.Equal(t, []Signature{sigA, sigB}, img.Provenance.Signatures)
+
+	// the earlier statement is kept when both are verified
+	require.NoError(t, addProvenanceStatement(&img, stmt(predB), []Signature{sigB}))
+	require.Equal(t, "https://example.com/a", img.Provenance.BuilderID)
+	require.Equal(t, []Signature{sigA, sigB}, img.Provenance.Signatures)
+
+	// verified provenance wins over unverified provenance, which wins over
+	// unsigned provenance, whatever the order they are read in
+	unverified := Signature{Type: SignatureTypeDSSE, Error: errNoMatchingKey, Identity: Identity{KeyID: "c"}}
+	for _, tc := range []struct {
+		name     string
+		first    []Signature
+		second   []Signature
+		expected string
+	}{
+		{name: "verified first", first: []Signature{sigA}, second: []Signature{unverified}, expected: "https://example.com/a"},
+		{name: "unverified first", first: []Signature{unverified}, second: []Signature{sigA}, expected: "https://example.com/b"},
+		{name: "unsigned first", first: nil, second: []Signature{unverified}, expected: "https://example.com/b"},
+		{name: "unsigned second", first: []Signature{unverified}, second: nil, expected: "https://example.com/a"},
+	} {
+		var img Image
+		require.NoError(t, addProvenanceStatement(&img, stmt(predA), tc.first), tc.name)
+		require.NoError(t, addProvenanceStatement(&img, stmt(predB), tc.second), tc.name)
+		require.Equal(t, tc.expected, img.Provenance.BuilderID, tc.name)
+	}
+}
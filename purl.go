@@ -0,0 +1,171 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PackageURL is a parsed package URL (purl), such as
+// "pkg:deb/debian/curl@7.74.0-1.3?arch=amd64".
+type PackageURL struct {
+	Type       string
+	Namespace  string `json:",omitempty"`
+	Name       string
+	Version    string            `json:",omitempty"`
+	Qualifiers map[string]string `json:",omitempty"`
+	Subpath    string            `json:",omitempty"`
+}
+
+// ParsePackageURL parses a package URL following the purl specification at
+// https://github.com/package-url/purl-spec.
+func ParsePackageURL(s string) (*PackageURL, error) {
+	scheme, rest, ok := strings.Cut(s, ":")
+	if !ok || !strings.EqualFold(scheme, "pkg") {
+		return nil, errors.Errorf("invalid package url %q: missing pkg scheme", s)
+	}
+
+	var p PackageURL
+
+	rest, subpath, _ := strings.Cut(rest, "#")
+	var segments []string
+	for _, seg := range strings.Split(subpath, "/") {
+		seg, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid package url %q", s)
+		}
+		if seg != "" && seg != "." && seg != ".." {
+			segments = append(segments, seg)
+		}
+	}
+	p.Subpath = strings.Join(segments, "/")
+
+	rest, qualifiers, _ := strings.Cut(rest, "?")
+	if qualifiers != "" {
+		for _, kv := range strings.Split(qualifiers, "&") {
+			k, v, _ := strings.Cut(kv, "=")
+			v, err := url.PathUnescape(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid package url %q", s)
+			}
+			if k == "" || v == "" {
+				continue
+			}
+			if p.Qualifiers == nil {
+				p.Qualifiers = make(map[string]string)
+			}
+			p.Qualifiers[strings.ToLower(k)] = v
+		}
+	}
+
+	rest = strings.Trim(rest, "/")
+	typ, rest, ok := strings.Cut(rest, "/")
+	if !ok || typ == "" {
+		return nil, errors.Errorf("invalid package url %q: missing type", s)
+	}
+	p.Type = strings.ToLower(typ)
+
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		v, err := url.PathUnescape(rest[i+1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid package url %q", s)
+		}
+		p.Version = v
+		rest = rest[:i]
+	}
+
+	segments = nil
+	for _, seg := range strings.Split(rest, "/") {
+		seg, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid package url %q", s)
+		}
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, errors.Errorf("invalid package url %q: missing name", s)
+	}
+	p.Name = segments[len(segments)-1]
+	p.Namespace = strings.Join(segments[:len(segments)-1], "/")
+
+	switch p.Type {
+	case "pypi":
+		p.Name = strings.ReplaceAll(strings.ToLower(p.Name), "_", "-")
+	case "github", "bitbucket":
+		p.Namespace = strings.ToLower(p.Namespace)
+		p.Name = strings.ToLower(p.Name)
+	}
+
+	return &p, nil
+}
+
+// String returns the canonical form of the package URL.
+func (p PackageURL) String() string {
+	var sb strings.Builder
+	sb.WriteString("pkg:")
+	sb.WriteString(p.Type)
+	sb.WriteString("/")
+	if p.Namespace != "" {
+		for _, seg := range strings.Split(p.Namespace, "/") {
+			sb.WriteString(escapePURL(seg))
+			sb.WriteString("/")
+		}
+	}
+	sb.WriteString(escapePURL(p.Name))
+	if p.Version != "" {
+		sb.WriteString("@")
+		sb.WriteString(escapePURL(p.Version))
+	}
+	if len(p.Qualifiers) > 0 {
+		keys := make([]string, 0, len(p.Qualifiers))
+		for k := range p.Qualifiers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			if i == 0 {
+				sb.WriteString("?")
+			} else {
+				sb.WriteString("&")
+			}
+			sb.WriteString(k)
+			sb.WriteString("=")
+			sb.WriteString(escapePURL(p.Qualifiers[k]))
+		}
+	}
+	if p.Subpath != "" {
+		sb.WriteString("#")
+		for i, seg := range strings.Split(p.Subpath, "/") {
+			if i > 0 {
+				sb.WriteString("/")
+			}
+			sb.WriteString(escapePURL(seg))
+		}
+	}
+	return sb.String()
+}
+
+func escapePURL(s string) string {
+	// ':' doesn't need to be encoded, as in the versions of deb and rpm
+	// packages with an epoch, but '@' does, as in npm scopes
+	s = strings.ReplaceAll(url.PathEscape(s), "%3A", ":")
+	return strings.ReplaceAll(s, "@", "%40")
+}
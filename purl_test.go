@@ -0,0 +1,122 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePackageURL(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		purl      string
+		expected  *PackageURL
+		canonical string
+	}{
+		{
+			purl: "pkg:deb/debian/curl@7.74.0-1.3+deb11u3?arch=amd64&distro=debian-11",
+			expected: &PackageURL{
+				Type:       "deb",
+				Namespace:  "debian",
+				Name:       "curl",
+				Version:    "7.74.0-1.3+deb11u3",
+				Qualifiers: map[string]string{"arch": "amd64", "distro": "debian-11"},
+			},
+		},
+		{
+			purl: "pkg:rpm/fedora/curl@1:7.50.3-1.fc25?Arch=i386",
+			expected: &PackageURL{
+				Type:       "rpm",
+				Namespace:  "fedora",
+				Name:       "curl",
+				Version:    "1:7.50.3-1.fc25",
+				Qualifiers: map[string]string{"arch": "i386"},
+			},
+			canonical: "pkg:rpm/fedora/curl@1:7.50.3-1.fc25?arch=i386",
+		},
+		{
+			purl: "pkg:npm/%40angular/animation@12.3.1",
+			expected: &PackageURL{
+				Type:      "npm",
+				Namespace: "@angular",
+				Name:      "animation",
+				Version:   "12.3.1",
+			},
+		},
+		{
+			purl: "pkg:golang/github.com/pkg/errors@v0.9.1#api/v1",
+			expected: &PackageURL{
+				Type:      "golang",
+				Namespace: "github.com/pkg",
+				Name:      "errors",
+				Version:   "v0.9.1",
+				Subpath:   "api/v1",
+			},
+		},
+		{
+			purl: "pkg:PyPI/Django_Rest@1.11.1",
+			expected: &PackageURL{
+				Type:    "pypi",
+				Name:    "django-rest",
+				Version: "1.11.1",
+			},
+			canonical: "pkg:pypi/django-rest@1.11.1",
+		},
+		{
+			purl: "pkg:generic/openssl?download_url=https%3A%2F%2Fopenssl.org&checksum=",
+			expected: &PackageURL{
+				Type:       "generic",
+				Name:       "openssl",
+				Qualifiers: map[string]string{"download_url": "https://openssl.org"},
+			},
+			canonical: "pkg:generic/openssl?download_url=https:%2F%2Fopenssl.org",
+		},
+		{
+			purl: "https://example.com/pkg",
+		},
+		{
+			purl: "pkg:curl",
+		},
+		{
+			purl: "pkg:deb/",
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.purl, func(t *testing.T) {
+			p, err := ParsePackageURL(tc.purl)
+			if tc.expected == nil {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, p)
+
+			canonical := tc.canonical
+			if canonical == "" {
+				canonical = tc.purl
+			}
+			require.Equal(t, canonical, p.String())
+
+			p2, err := ParsePackageURL(p.String())
+			require.NoError(t, err)
+			require.Equal(t, p, p2)
+		})
+	}
+}
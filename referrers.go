@@ -0,0 +1,317 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/reference"
+	distref "github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/containerd/containerd/version"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// ReferrersFetcher is implemented by resolvers that support the OCI
+// distribution referrers API. FetchReferrers returns an error matching
+// errdefs.IsNotFound or errdefs.IsNotImplemented if the API is not
+// available. The loader falls back to the referrers tag schema if
+// FetchReferrers fails for any reason.
+type ReferrersFetcher interface {
+	FetchReferrers(ctx context.Context, ref string, dgst digest.Digest) ([]ocispec.Descriptor, error)
+}
+
+// RegistryResolver is a registry resolver that also supports the OCI
+// distribution referrers API.
+type RegistryResolver struct {
+	remotes.Resolver
+	hosts  docker.RegistryHosts
+	header http.Header
+}
+
+var _ ReferrersFetcher = &RegistryResolver{}
+
+// NewRegistryResolver returns a resolver for opts that shares its registry
+// hosts, and so its authorizer, with the referrers API requests. Defaults
+// are the same as docker.NewResolver.
+func NewRegistryResolver(opts docker.ResolverOptions) *RegistryResolver {
+	if opts.Headers == nil {
+		opts.Headers = make(http.Header)
+	}
+	if _, ok := opts.Headers["User-Agent"]; !ok {
+		opts.Headers.Set("User-Agent", "containerd/"+version.Version)
+	}
+	if opts.Hosts == nil {
+		opts.Hosts = defaultRegistryHosts(opts)
+	}
+	return &RegistryResolver{
+		Resolver: docker.NewResolver(opts),
+		hosts:    opts.Hosts,
+		header:   opts.Headers,
+	}
+}
+
+// defaultRegistryHosts configures the registry hosts the same way
+// docker.NewResolver does when no hosts are set.
+func defaultRegistryHosts(opts docker.ResolverOptions) docker.RegistryHosts {
+	var hostOpts []docker.RegistryOpt
+	if opts.Host != nil {
+		hostOpts = append(hostOpts, docker.WithHostTranslator(opts.Host))
+	}
+	authorizer := opts.Authorizer
+	if authorizer == nil {
+		authorizer = docker.NewDockerAuthorizer(
+			docker.WithAuthClient(opts.Client),
+			docker.WithAuthHeader(opts.Headers),
+			docker.WithAuthCreds(opts.Credentials),
+		)
+	}
+	hostOpts = append(hostOpts, docker.WithAuthorizer(authorizer))
+	if opts.Client != nil {
+		hostOpts = append(hostOpts, docker.WithClient(opts.Client))
+	}
+	if opts.PlainHTTP {
+		hostOpts = append(hostOpts, docker.WithPlainHTTP(docker.MatchAllHosts))
+	} else {
+		hostOpts = append(hostOpts, docker.WithPlainHTTP(docker.MatchLocalhost))
+	}
+	return docker.ConfigureDefaultRegistries(hostOpts...)
+}
+
+func (r *RegistryResolver) FetchReferrers(ctx context.Context, ref string, dgst digest.Digest) ([]ocispec.Descriptor, error) {
+	refspec, err := reference.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := r.hosts(refspec.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	ctx, err = docker.ContextWithRepositoryScope(ctx, refspec, false)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := refspec.Locator[len(refspec.Hostname())+1:]
+
+	var lastErr error = errors.Wrapf(errdefs.ErrNotFound, "no registry host for %s", ref)
+	for _, host := range hosts {
+		if !host.Capabilities.Has(docker.HostCapabilityResolve) {
+			continue
+		}
+		u := url.URL{
+			Scheme: host.Scheme,
+			Host:   host.Host,
+			Path:   fmt.Sprintf("%s/%s/referrers/%s", host.Path, repo, dgst),
+		}
+		descs, err := fetchReferrersFromHost(ctx, host, r.header, u.String())
+		if err == nil {
+			return descs, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// fetchReferrersFromHost fetches the referrers index at u from host, following
+// the Link header of paginated responses.
+func fetchReferrersFromHost(ctx context.Context, host docker.RegistryHost, header http.Header, u string) ([]ocispec.Descriptor, error) {
+	var descs []ocispec.Descriptor
+	seen := map[string]bool{}
+	for u != "" && !seen[u] {
+		seen[u] = true
+		page, next, err := fetchReferrersPage(ctx, host, header, u)
+		if err != nil {
+			return nil, err
+		}
+		descs = append(descs, page...)
+		u = next
+	}
+	return descs, nil
+}
+
+// fetchReferrersPage fetches a page of the referrers index and returns the
+// URL of the next page, if any. Any status other than 200 means the registry
+// doesn't support the referrers API.
+func fetchReferrersPage(ctx context.Context, host docker.RegistryHost, header http.Header, u string) ([]ocispec.Descriptor, string, error) {
+	client := host.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var resp *http.Response
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		for k, v := range host.Header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Accept", ocispec.MediaTypeImageIndex)
+		if host.Authorizer != nil {
+			if err := host.Authorizer.Authorize(ctx, req); err != nil {
+				return nil, "", err
+			}
+		}
+
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || host.Authorizer == nil || i > 0 {
+			break
+		}
+		resp.Body.Close()
+		if err := host.Authorizer.AddResponses(ctx, []*http.Response{resp}); err != nil {
+			return nil, "", err
+		}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusBadRequest:
+		return nil, "", errors.Wrapf(errdefs.ErrNotFound, "referrers api not available on %s: %s", host.Host, resp.Status)
+	default:
+		return nil, "", errors.Wrapf(errdefs.ErrNotImplemented, "unexpected status fetching referrers from %s: %s", host.Host, resp.Status)
+	}
+
+	var idx ocispec.Index
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&idx); err != nil {
+		return nil, "", errors.Wrap(err, "failed to decode referrers response")
+	}
+	return idx.Manifests, nextLink(resp), nil
+}
+
+// nextLink returns the URL of the rel="next" Link header of resp, resolved
+// against the request URL.
+func nextLink(resp *http.Response) string {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			params := strings.Split(link, ";")
+			target := strings.TrimSpace(params[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, p := range params[1:] {
+				k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+				if !ok || strings.TrimSpace(k) != "rel" || strings.Trim(strings.TrimSpace(v), `"`) != "next" {
+					continue
+				}
+				ref, err := url.Parse(target[1 : len(target)-1])
+				if err != nil {
+					return ""
+				}
+				return resp.Request.URL.ResolveReference(ref).String()
+			}
+		}
+	}
+	return ""
+}
+
+// fetchReferrers adds the artifacts referring to each of subjects to r as
+// attestation manifests of that subject.
+func (l *Loader) fetchReferrers(ctx context.Context, named distref.Named, fetcher remotes.Fetcher, r *result, subjects []digest.Digest) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, subject := range subjects {
+		subject := subject
+		eg.Go(func() error {
+			descs, err := l.referrers(ctx, named, subject)
+			if err != nil {
+				return r.recordSubjectError(l, ComponentReferrers, subject, errors.Wrapf(err, "failed to fetch referrers of %s", subject))
+			}
+			for _, desc := range descs {
+				switch desc.MediaType {
+				case images.MediaTypeDockerSchema2Manifest, ocispec.MediaTypeImageManifest:
+				default:
+					continue
+				}
+				annotations := make(map[string]string, len(desc.Annotations)+1)
+				for k, v := range desc.Annotations {
+					annotations[k] = v
+				}
+				annotations[AnnotationReference] = subject.String()
+				desc.Annotations = annotations
+				if err := r.recordFetchError(l, desc, l.fetch(ctx, fetcher, desc, r)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+func (l *Loader) referrers(ctx context.Context, named distref.Named, subject digest.Digest) ([]ocispec.Descriptor, error) {
+	if rf, ok := l.opt.Resolver.(ReferrersFetcher); ok {
+		canonical, err := distref.WithDigest(named, subject)
+		if err != nil {
+			return nil, err
+		}
+		descs, err := rf.FetchReferrers(ctx, canonical.String(), subject)
+		if err == nil {
+			return descs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	// fall back to the referrers tag schema
+	tagged, err := distref.WithTag(distref.TrimNamed(named), subject.Algorithm().String()+"-"+subject.Hex())
+	if err != nil {
+		return nil, err
+	}
+	_, desc, err := l.opt.Resolver.Resolve(ctx, tagged.String())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	fetcher, err := l.opt.Resolver.Fetcher(ctx, tagged.String())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := remotes.FetchHandler(l.cache, fetcher)(ctx, desc); err != nil {
+		return nil, err
+	}
+	dt, err := content.ReadBlob(ctx, l.cache, desc)
+	if err != nil {
+		return nil, err
+	}
+	var idx ocispec.Index
+	if err := json.Unmarshal(dt, &idx); err != nil {
+		return nil, err
+	}
+	return idx.Manifests, nil
+}
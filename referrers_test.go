@@ -0,0 +1,304 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/go-imageinspect/testutil"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const testSPDX = `{
+  "spdxVersion": "SPDX-2.3",
+  "dataLicense": "CC0-1.0",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "name": "test",
+  "documentNamespace": "https://example.com/test",
+  "creationInfo": {
+    "created": "2022-11-22T10:00:00Z",
+    "creators": ["Tool: test"]
+  },
+  "packages": [
+    {
+      "name": "busybox",
+      "SPDXID": "SPDXRef-Package-busybox",
+      "versionInfo": "1.35.0-r17",
+      "downloadLocation": "NOASSERTION",
+      "externalRefs": [
+        {
+          "referenceCategory": "PACKAGE_MANAGER",
+          "referenceType": "purl",
+          "referenceLocator": "pkg:alpine/busybox@1.35.0-r17"
+        }
+      ]
+    }
+  ]
+}`
+
+// failingReferrers is a resolver whose referrers API fails with an
+// unexpected error.
+type failingReferrers struct {
+	*testutil.Env
+}
+
+func (failingReferrers) FetchReferrers(ctx context.Context, ref string, dgst digest.Digest) ([]ocispec.Descriptor, error) {
+	return nil, errors.New("unexpected status fetching referrers: 500 Internal Server Error")
+}
+
+func TestReferrers(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"api", "tag", "failing api"} {
+		name := name
+		api := name == "api"
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			env := testutil.NewEnv(t)
+			env.SetReferrersAPI(api)
+
+			cfg, err := testutil.Config(ocispec.Image{})
+			require.NoError(t, err)
+			_, err = env.AddBlob(cfg)
+			require.NoError(t, err)
+
+			mfst, err := testutil.Manifest(ocispec.Manifest{
+				Config: cfg.Descriptor,
+			})
+			require.NoError(t, err)
+			_, err = env.AddBlob(mfst)
+			require.NoError(t, err)
+
+			require.NoError(t, env.AddTag("docker.io/library/test:latest", mfst.Descriptor.Digest))
+
+			// provenance statement without predicate type annotation
+			stmt, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+				"builder": map[string]string{"id": "https://example.com/builder"},
+			})
+			require.NoError(t, err)
+			stmt.Descriptor.Annotations = nil
+			_, err = env.AddBlob(stmt)
+			require.NoError(t, err)
+
+			sbom := &testutil.Blob{
+				Data: []byte(testSPDX),
+				Descriptor: ocispec.Descriptor{
+					MediaType: "application/spdx+json",
+					Digest:    digest.FromString(testSPDX),
+					Size:      int64(len(testSPDX)),
+				},
+			}
+			_, err = env.AddBlob(sbom)
+			require.NoError(t, err)
+
+			var referrers []ocispec.Descriptor
+			for _, layer := range []ocispec.Descriptor{stmt.Descriptor, sbom.Descriptor} {
+				artifact, err := testutil.Manifest(ocispec.Manifest{
+					Config: ocispec.Descriptor{
+						MediaType: "application/vnd.oci.empty.v1+json",
+						Digest:    digest.FromString("{}"),
+						Size:      2,
+					},
+					Layers: []ocispec.Descriptor{layer},
+				})
+				require.NoError(t, err)
+				_, err = env.AddBlob(artifact)
+				require.NoError(t, err)
+
+				env.AddReferrer(mfst.Descriptor.Digest, artifact.Descriptor)
+				referrers = append(referrers, artifact.Descriptor)
+			}
+
+			if !api {
+				idx, err := testutil.Index(ocispec.Index{
+					Manifests: referrers,
+				})
+				require.NoError(t, err)
+				_, err = env.AddBlob(idx)
+				require.NoError(t, err)
+				require.NoError(t, env.AddTag("docker.io/library/test:sha256-"+mfst.Descriptor.Digest.Hex(), idx.Descriptor.Digest))
+			}
+
+			var resolver remotes.Resolver = env
+			if name == "failing api" {
+				// falls back to the tag schema
+				resolver = failingReferrers{env}
+			}
+
+			l, err := NewLoader(Opt{
+				CacheDir: t.TempDir(),
+				Resolver: resolver,
+			})
+			require.NoError(t, err)
+
+			r, err := l.Load(ctx, "test")
+			require.NoError(t, err)
+
+			require.Equal(t, []string{"linux/amd64"}, r.Platforms)
+
+			img, ok := r.Images["linux/amd64"]
+			require.True(t, ok)
+
+			require.NotNil(t, img.Provenance)
+			require.Equal(t, "https://example.com/builder", img.Provenance.BuilderID)
+
+			require.NotNil(t, img.SBOM)
+			require.Equal(t, 1, len(img.SBOM.AlpinePackages))
+			require.Equal(t, "busybox", img.SBOM.AlpinePackages[0].Name)
+		})
+	}
+}
+
+func TestRegistryResolverToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mfst, err := testutil.Manifest(ocispec.Manifest{
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromString("{}"),
+			Size:      2,
+		},
+	})
+	require.NoError(t, err)
+	artifact := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString("artifact"),
+		Size:      8,
+	}
+
+	var srv *httptest.Server
+	var tokens int
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("service") != "registry" || r.URL.Query().Get("scope") != "repository:test/img:pull" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tokens++
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="registry",scope="repository:test/img:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("User-Agent"), "containerd/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/test/img/manifests/latest":
+			w.Header().Set("Content-Type", mfst.Descriptor.MediaType)
+			w.Header().Set("Docker-Content-Digest", mfst.Descriptor.Digest.String())
+			w.Header().Set("Content-Length", "0")
+		case "/v2/test/img/referrers/" + mfst.Descriptor.Digest.String():
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+			_ = json.NewEncoder(w).Encode(ocispec.Index{Manifests: []ocispec.Descriptor{artifact}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	r := NewRegistryResolver(docker.ResolverOptions{
+		Host: func(string) (string, error) {
+			return u.Host, nil
+		},
+		PlainHTTP: true,
+	})
+
+	_, desc, err := r.Resolve(ctx, "registry.example.com/test/img:latest")
+	require.NoError(t, err)
+	require.Equal(t, mfst.Descriptor.Digest, desc.Digest)
+
+	descs, err := r.FetchReferrers(ctx, "registry.example.com/test/img@"+desc.Digest.String(), desc.Digest)
+	require.NoError(t, err)
+	require.Equal(t, []ocispec.Descriptor{artifact}, descs)
+	require.Equal(t, 1, tokens)
+}
+
+func TestRegistryResolverPagination(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	subject := digest.FromString("subject")
+	forbidden := digest.FromString("forbidden")
+	artifact := func(s string) ocispec.Descriptor {
+		return ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Digest:    digest.FromString(s),
+			Size:      int64(len(s)),
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/test/img/referrers/" + subject.String():
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/test/img/referrers/`+subject.String()+`?last=a>; rel="next"`)
+				_ = json.NewEncoder(w).Encode(ocispec.Index{Manifests: []ocispec.Descriptor{artifact("a")}})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(ocispec.Index{Manifests: []ocispec.Descriptor{artifact("b")}})
+		case "/v2/test/img/referrers/" + forbidden.String():
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	r := NewRegistryResolver(docker.ResolverOptions{
+		Host: func(string) (string, error) {
+			return u.Host, nil
+		},
+		PlainHTTP: true,
+	})
+
+	descs, err := r.FetchReferrers(ctx, "registry.example.com/test/img@"+subject.String(), subject)
+	require.NoError(t, err)
+	require.Equal(t, []ocispec.Descriptor{artifact("a"), artifact("b")}, descs)
+
+	// unexpected statuses mean the referrers api is not available
+	_, err = r.FetchReferrers(ctx, "registry.example.com/test/img@"+forbidden.String(), forbidden)
+	require.Error(t, err)
+	require.True(t, errdefs.IsNotImplemented(err))
+}
@@ -16,24 +16,74 @@ package imageinspect
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
+	"io"
+	"regexp"
 	"sort"
 	"strings"
 
-	"github.com/containerd/containerd/content"
-	"github.com/containerd/containerd/remotes"
-	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	spdx_json "github.com/spdx/tools-golang/json"
 	spdx_common "github.com/spdx/tools-golang/spdx/common"
+	spdx_v2_2 "github.com/spdx/tools-golang/spdx/v2_2"
 	spdx "github.com/spdx/tools-golang/spdx/v2_3"
+	spdx_tv "github.com/spdx/tools-golang/tvloader"
+	spdx_yaml "github.com/spdx/tools-golang/yaml"
+	"sigs.k8s.io/yaml"
 )
 
 type SBOM struct {
-	AlpinePackages  []Package `json:",omitempty"`
-	UnknownPackages []Package `json:",omitempty"`
+	AlpinePackages   []Package `json:",omitempty"`
+	DebianPackages   []Package `json:",omitempty"`
+	RPMPackages      []Package `json:",omitempty"`
+	GoPackages       []Package `json:",omitempty"`
+	NPMPackages      []Package `json:",omitempty"`
+	PyPIPackages     []Package `json:",omitempty"`
+	MavenPackages    []Package `json:",omitempty"`
+	GemPackages      []Package `json:",omitempty"`
+	CargoPackages    []Package `json:",omitempty"`
+	NuGetPackages    []Package `json:",omitempty"`
+	ComposerPackages []Package `json:",omitempty"`
+	GenericPackages  []Package `json:",omitempty"`
+	UnknownPackages  []Package `json:",omitempty"`
+
+	// Documents are the SBOM documents the packages were read from.
+	Documents []SBOMDocument `json:",omitempty"`
+	// Relationships are the relationships between the packages and
+	// documents. Dependency relationships are also recorded in the
+	// Dependencies of the packages.
+	Relationships []Relationship `json:",omitempty"`
+}
+
+const (
+	SBOMFormatSPDX      = "spdx"
+	SBOMFormatCycloneDX = "cyclonedx"
+)
+
+// SBOMDocument is an SBOM document attached to the image.
+type SBOMDocument struct {
+	// ID is the SPDX document namespace or the CycloneDX serial number of
+	// the document, or the digest of the document if it has none.
+	ID     string
+	Format string
+	Name   string `json:",omitempty"`
+
+	// Signatures are the signatures of the attestations the document was
+	// read from. It is empty if none of them were signed.
+	Signatures []Signature `json:",omitempty"`
+}
+
+// addDocument adds doc to the documents of the SBOM. If the same document was
+// already read from another attestation, only its signatures are added.
+func (s *SBOM) addDocument(doc SBOMDocument) {
+	for i, d := range s.Documents {
+		if d.ID == doc.ID {
+			s.Documents[i].Signatures = append(s.Documents[i].Signatures, doc.Signatures...)
+			return
+		}
+	}
+	s.Documents = append(s.Documents, doc)
 }
 
 type pkgType int
@@ -41,9 +91,83 @@ type pkgType int
 const (
 	pkgTypeUnknown pkgType = iota
 	pkgTypeAlpine
+	pkgTypeDebian
+	pkgTypeRPM
+	pkgTypeGo
+	pkgTypeNPM
+	pkgTypePyPI
+	pkgTypeMaven
+	pkgTypeGem
+	pkgTypeCargo
+	pkgTypeNuGet
+	pkgTypeComposer
+	pkgTypeGeneric
+
+	numPkgTypes
 )
 
+// pkgTypes maps purl types to the package lists of the SBOM.
+var pkgTypes = map[string]pkgType{
+	"alpine":   pkgTypeAlpine,
+	"apk":      pkgTypeAlpine,
+	"deb":      pkgTypeDebian,
+	"rpm":      pkgTypeRPM,
+	"golang":   pkgTypeGo,
+	"npm":      pkgTypeNPM,
+	"pypi":     pkgTypePyPI,
+	"maven":    pkgTypeMaven,
+	"gem":      pkgTypeGem,
+	"cargo":    pkgTypeCargo,
+	"nuget":    pkgTypeNuGet,
+	"composer": pkgTypeComposer,
+	"generic":  pkgTypeGeneric,
+}
+
+func (s *SBOM) packages(typ pkgType) *[]Package {
+	switch typ {
+	case pkgTypeAlpine:
+		return &s.AlpinePackages
+	case pkgTypeDebian:
+		return &s.DebianPackages
+	case pkgTypeRPM:
+		return &s.RPMPackages
+	case pkgTypeGo:
+		return &s.GoPackages
+	case pkgTypeNPM:
+		return &s.NPMPackages
+	case pkgTypePyPI:
+		return &s.PyPIPackages
+	case pkgTypeMaven:
+		return &s.MavenPackages
+	case pkgTypeGem:
+		return &s.GemPackages
+	case pkgTypeCargo:
+		return &s.CargoPackages
+	case pkgTypeNuGet:
+		return &s.NuGetPackages
+	case pkgTypeComposer:
+		return &s.ComposerPackages
+	case pkgTypeGeneric:
+		return &s.GenericPackages
+	default:
+		return &s.UnknownPackages
+	}
+}
+
+// addPackage adds pkg to the package list of its purl type.
+func (s *SBOM) addPackage(pkg Package) {
+	typ := pkgTypeUnknown
+	if pkg.PURL != nil {
+		typ = pkgTypes[pkg.PURL.Type]
+	}
+	list := s.packages(typ)
+	*list = append(*list, pkg)
+}
+
 type Package struct {
+	// ID identifies the package in the SBOM. It is the package URL of the
+	// package, or its name and version if it has none.
+	ID          string
 	Name        string
 	Version     string
 	Description string
@@ -53,81 +177,67 @@ type Package struct {
 	License     []string
 	Files       []string
 
+	// PURL is the package URL of the package, if it has a valid one.
+	PURL *PackageURL `json:",omitempty"`
 	CPEs []string
-}
 
-type PackageCreator struct {
-	Name string // TODO: split name and e-mail
-	Org  string `json:",omitempty"`
-}
+	// Hashes are the checksums of the package by lowercase algorithm name,
+	// such as "sha256".
+	Hashes map[string]string `json:",omitempty"`
+	// Dependencies are the IDs of the packages the package directly
+	// depends on.
+	Dependencies []string `json:",omitempty"`
 
-type spdxStatement struct {
-	intoto.StatementHeader
-	Predicate json.RawMessage `json:"predicate"`
+	// Sources are the IDs of the SBOM documents listing the package.
+	Sources []string `json:",omitempty"`
 }
 
-func (l *Loader) scanSBOM(ctx context.Context, fetcher remotes.Fetcher, r *result, subject digest.Digest, refs []digest.Digest, img *Image) error {
-	ctx = remotes.WithMediaTypeKeyPrefix(ctx, "application/vnd.in-toto+json", "intoto")
-
-	for _, dgst := range refs {
-		mfst, ok := r.manifests[dgst]
-		if !ok {
-			return errors.Errorf("referenced image %s not found", dgst)
-		}
-
-		for _, layer := range mfst.manifest.Layers {
-			if layer.MediaType == "application/vnd.in-toto+json" && layer.Annotations["in-toto.io/predicate-type"] == "https://spdx.dev/Document" {
-				var stmt spdxStatement
-				_, err := remotes.FetchHandler(l.cache, fetcher)(ctx, layer)
-				if err != nil {
-					return err
-				}
-				dt, err := content.ReadBlob(ctx, l.cache, layer)
-				if err != nil {
-					return err
-				}
-				if err := json.Unmarshal(dt, &stmt); err != nil {
-					return err
-				}
-
-				if stmt.PredicateType != "https://spdx.dev/Document" {
-					return errors.Errorf("unexpected predicate type %s", stmt.PredicateType)
-				}
-
-				subjectValidated := false
-				for _, s := range stmt.Subject {
-					for alg, hash := range s.Digest {
-						if alg+":"+hash == subject.String() {
-							subjectValidated = true
-							break
-						}
-					}
-				}
-
-				if !subjectValidated {
-					return errors.Errorf("unable to validate subject %s, expected %s", stmt.Subject, subject.String())
-				}
-
-				doc, err := decodeSPDX(stmt.Predicate)
-				if err != nil {
-					return err
-				}
-				addSPDX(img, doc)
-			}
-		}
+// setID sets the ID of pkg from its package URL, name and version.
+func (pkg *Package) setID() {
+	if pkg.PURL != nil {
+		pkg.ID = pkg.PURL.String()
+		return
+	}
+	pkg.ID = pkg.Name
+	if pkg.Version != "" {
+		pkg.ID += "@" + pkg.Version
 	}
+}
 
-	normalizeSBOM(img.SBOM)
+// hashAlgorithm normalizes the names of hash algorithms used by SBOM
+// formats, such as "SHA256" and "SHA-256".
+func hashAlgorithm(alg string) string {
+	alg = strings.ToLower(alg)
+	if strings.HasPrefix(alg, "sha-") {
+		alg = "sha" + strings.TrimPrefix(alg, "sha-")
+	}
+	return alg
+}
 
-	return nil
+type PackageCreator struct {
+	Name string // TODO: split name and e-mail
+	Org  string `json:",omitempty"`
 }
 
-func addSPDX(img *Image, doc spdxDocument) {
+func addSPDX(img *Image, doc spdxDocument, sigs []Signature) {
 	sbom := img.SBOM
 	if sbom == nil {
 		sbom = &SBOM{}
 	}
 
+	source := SBOMDocument{
+		ID:         doc.DocumentNamespace,
+		Format:     SBOMFormatSPDX,
+		Name:       doc.DocumentName,
+		Signatures: sigs,
+	}
+	if source.ID == "" {
+		source.ID = doc.Digest.String()
+	}
+	sbom.addDocument(source)
+
+	pkgs := make([]Package, 0, len(doc.Packages))
+	ids := map[spdx_common.ElementID]int{}
 	for _, p := range doc.Packages {
 		var files []string
 		for _, relationship := range doc.RelationshipsByPackageID[p.PackageSPDXIdentifier] {
@@ -160,24 +270,75 @@ func addSPDX(img *Image, doc spdxDocument) {
 			pkg.Creator = creator
 		}
 
-		typ := pkgTypeUnknown
 		for _, ref := range p.PackageExternalReferences {
-			if ref.Category == "PACKAGE_MANAGER" && ref.RefType == "purl" {
-				if strings.HasPrefix(ref.Locator, "pkg:alpine/") {
-					typ = pkgTypeAlpine
+			// SPDX 2.3 renamed the PACKAGE_MANAGER category
+			if (ref.Category == "PACKAGE_MANAGER" || ref.Category == "PACKAGE-MANAGER") && ref.RefType == "purl" && pkg.PURL == nil {
+				if purl, err := ParsePackageURL(ref.Locator); err == nil {
+					pkg.PURL = purl
 				}
 			}
 			if ref.Category == "SECURITY" && ref.RefType == "cpe23Type" {
 				pkg.CPEs = append(pkg.CPEs, ref.Locator)
 			}
 		}
+		pkg.setID()
+		pkg.Sources = []string{source.ID}
+
+		for _, c := range p.PackageChecksums {
+			if pkg.Hashes == nil {
+				pkg.Hashes = make(map[string]string)
+			}
+			pkg.Hashes[hashAlgorithm(string(c.Algorithm))] = c.Value
+		}
+
+		ids[p.PackageSPDXIdentifier] = len(pkgs)
+		pkgs = append(pkgs, pkg)
+	}
 
-		switch typ {
-		case pkgTypeAlpine:
-			sbom.AlpinePackages = append(sbom.AlpinePackages, pkg)
-		default:
-			sbom.UnknownPackages = append(sbom.UnknownPackages, pkg)
+	// relationships with files and other documents aren't kept
+	elementID := func(ref spdx_common.DocElementID) (string, bool) {
+		if ref.DocumentRefID != "" || ref.SpecialID != "" {
+			return "", false
+		}
+		if ref.ElementRefID == doc.SPDXIdentifier {
+			return source.ID, true
 		}
+		if i, ok := ids[ref.ElementRefID]; ok {
+			return pkgs[i].ID, true
+		}
+		return "", false
+	}
+	for _, r := range doc.Relationships {
+		from, ok := elementID(r.RefA)
+		if !ok {
+			continue
+		}
+		to, ok := elementID(r.RefB)
+		if !ok {
+			continue
+		}
+		rel := Relationship{From: from, Type: strings.ToUpper(r.Relationship), To: to}
+		sbom.Relationships = append(sbom.Relationships, rel)
+
+		ok, reverse := rel.isDependency()
+		if !ok {
+			continue
+		}
+		pkgRef, depRef := r.RefA, r.RefB
+		if reverse {
+			pkgRef, depRef = r.RefB, r.RefA
+		}
+		i, ok := ids[pkgRef.ElementRefID]
+		if !ok {
+			continue
+		}
+		if j, ok := ids[depRef.ElementRefID]; ok {
+			pkgs[i].Dependencies = append(pkgs[i].Dependencies, pkgs[j].ID)
+		}
+	}
+
+	for _, pkg := range pkgs {
+		sbom.addPackage(pkg)
 	}
 	img.SBOM = sbom
 }
@@ -187,8 +348,10 @@ func normalizeSBOM(sbom *SBOM) {
 		return
 	}
 
-	for _, pkgs := range [][]Package{sbom.AlpinePackages, sbom.UnknownPackages} {
-		// TODO: remote duplicates
+	for typ := pkgTypeUnknown; typ < numPkgTypes; typ++ {
+		list := sbom.packages(typ)
+		pkgs := mergePackages(*list)
+		*list = pkgs
 		sort.Slice(pkgs, func(i, j int) bool {
 			if pkgs[i].Name == pkgs[j].Name {
 				return pkgs[i].Version < pkgs[j].Version
@@ -196,17 +359,211 @@ func normalizeSBOM(sbom *SBOM) {
 			return pkgs[i].Name < pkgs[j].Name
 		})
 	}
+
+	// the same relationships are listed by duplicate documents
+	seen := make(map[Relationship]struct{}, len(sbom.Relationships))
+	rels := sbom.Relationships[:0]
+	for _, r := range sbom.Relationships {
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		rels = append(rels, r)
+	}
+	sbom.Relationships = rels
+}
+
+// mergePackages merges the packages with the same ID, such as the packages
+// listed by several SBOM documents, keeping the first occurrence of each.
+func mergePackages(pkgs []Package) []Package {
+	index := make(map[string]int, len(pkgs))
+	merged := make([]Package, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		if i, ok := index[pkg.ID]; ok && pkg.ID != "" {
+			merged[i].merge(pkg)
+			continue
+		}
+		index[pkg.ID] = len(merged)
+		merged = append(merged, pkg)
+	}
+	return merged
+}
+
+// merge adds the information of other about the same package to pkg.
+func (pkg *Package) merge(other Package) {
+	setIfEmpty(&pkg.Name, other.Name)
+	setIfEmpty(&pkg.Version, other.Version)
+	setIfEmpty(&pkg.Description, other.Description)
+	setIfEmpty(&pkg.DownloadURL, other.DownloadURL)
+	setIfEmpty(&pkg.HomepageURL, other.HomepageURL)
+	if pkg.Creator == (PackageCreator{}) {
+		pkg.Creator = other.Creator
+	}
+	if pkg.PURL == nil {
+		pkg.PURL = other.PURL
+	}
+
+	pkg.License = unionStrings(pkg.License, other.License)
+	pkg.Files = unionStrings(pkg.Files, other.Files)
+	pkg.CPEs = unionStrings(pkg.CPEs, other.CPEs)
+	pkg.Dependencies = unionStrings(pkg.Dependencies, other.Dependencies)
+	pkg.Sources = unionStrings(pkg.Sources, other.Sources)
+
+	for alg, h := range other.Hashes {
+		if _, ok := pkg.Hashes[alg]; ok {
+			continue
+		}
+		if pkg.Hashes == nil {
+			pkg.Hashes = make(map[string]string)
+		}
+		pkg.Hashes[alg] = h
+	}
+}
+
+func setIfEmpty(s *string, v string) {
+	if *s == "" {
+		*s = v
+	}
+}
+
+// unionStrings returns the strings of a followed by the ones of b that aren't
+// in a.
+func unionStrings(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	seen := make(map[string]struct{}, len(a)+len(b))
+	out := make([]string, 0, len(a)+len(b))
+	for _, l := range [][]string{a, b} {
+		for _, s := range l {
+			if _, ok := seen[s]; ok {
+				continue
+			}
+			seen[s] = struct{}{}
+			out = append(out, s)
+		}
+	}
+	return out
 }
 
+const (
+	spdxVersion2_2 = "SPDX-2.2"
+	spdxVersion2_3 = "SPDX-2.3"
+)
+
+var spdxTagValueVersion = regexp.MustCompile(`(?m)^SPDXVersion:[ \t]*(\S+)`)
+
+// decodeSPDX decodes an SPDX 2.2 or 2.3 document in the JSON, YAML or
+// tag-value format. Documents stored as JSON strings, as can be the case for
+// the predicate of in-toto statements, are decoded from the string.
 func decodeSPDX(dt []byte) (s spdxDocument, err error) {
-	doc, err := spdx_json.Load2_3(bytes.NewReader(dt))
+	dgst := digest.FromBytes(dt)
+
+	dt = bytes.TrimSpace(dt)
+	if bytes.HasPrefix(dt, []byte(`"`)) {
+		var str string
+		if err := json.Unmarshal(dt, &str); err != nil {
+			return spdxDocument{}, errors.Wrap(err, "unable to decode spdx")
+		}
+		dt = bytes.TrimSpace([]byte(str))
+	}
+
+	var doc *spdx.Document
+	switch {
+	case bytes.HasPrefix(dt, []byte("{")):
+		doc, err = loadSPDX(dt, json.Unmarshal, spdx_json.Load2_2, spdx_json.Load2_3)
+	case spdxTagValueVersion.Match(dt):
+		doc, err = loadSPDX(dt, unmarshalSPDXTagValue, spdx_tv.Load2_2, spdx_tv.Load2_3)
+	default:
+		unmarshal := func(dt []byte, v interface{}) error {
+			return yaml.Unmarshal(dt, v)
+		}
+		doc, err = loadSPDX(dt, unmarshal, spdx_yaml.Load2_2, spdx_yaml.Load2_3)
+	}
 	if err != nil {
 		return spdxDocument{}, errors.Wrap(err, "unable to decode spdx")
 	}
 	if doc == nil {
 		return spdxDocument{}, errors.New("decoding produced empty spdx document")
 	}
-	return newSPDXWrapper(doc), nil
+	s = newSPDXWrapper(doc)
+	s.Digest = dgst
+	return s, nil
+}
+
+type spdxHeader struct {
+	SPDXVersion string `json:"spdxVersion"`
+}
+
+// loadSPDX reads the version of an SPDX document with unmarshal and loads it
+// with the loader of that version. SPDX 2.2 documents are converted to SPDX
+// 2.3, which only adds fields.
+func loadSPDX(dt []byte, unmarshal func([]byte, interface{}) error, load2_2 func(io.Reader) (*spdx_v2_2.Document, error), load2_3 func(io.Reader) (*spdx.Document, error)) (*spdx.Document, error) {
+	var header spdxHeader
+	if err := unmarshal(dt, &header); err != nil {
+		return nil, err
+	}
+
+	switch header.SPDXVersion {
+	case spdxVersion2_3:
+		return load2_3(bytes.NewReader(dt))
+	case spdxVersion2_2:
+		doc, err := load2_2(bytes.NewReader(dt))
+		if err != nil || doc == nil {
+			return nil, err
+		}
+		// the JSON encoding of both versions is compatible
+		dt, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		return spdx_json.Load2_3(bytes.NewReader(unescapeHTML(dt)))
+	default:
+		return nil, errors.Errorf("unsupported spdx version %q", header.SPDXVersion)
+	}
+}
+
+// unescapeHTML replaces the escapes of "<", ">" and "&" added by json.Marshal
+// with the characters themselves. The SPDX loaders parse values such as
+// originators and creators without decoding escapes.
+func unescapeHTML(dt []byte) []byte {
+	out := make([]byte, 0, len(dt))
+	for i := 0; i < len(dt); i++ {
+		if dt[i] != '\\' || i+1 == len(dt) {
+			out = append(out, dt[i])
+			continue
+		}
+		if dt[i+1] == 'u' && i+6 <= len(dt) {
+			var c byte
+			switch string(dt[i+2 : i+6]) {
+			case "003c":
+				c = '<'
+			case "003e":
+				c = '>'
+			case "0026":
+				c = '&'
+			}
+			if c != 0 {
+				out = append(out, c)
+				i += 5
+				continue
+			}
+		}
+		// keep other escapes, including escaped backslashes, as they are
+		out = append(out, dt[i], dt[i+1])
+		i++
+	}
+	return out
+}
+
+// unmarshalSPDXTagValue reads the version of a tag-value SPDX document.
+func unmarshalSPDXTagValue(dt []byte, v interface{}) error {
+	m := spdxTagValueVersion.FindSubmatch(dt)
+	if m == nil {
+		return errors.New("missing SPDXVersion")
+	}
+	v.(*spdxHeader).SPDXVersion = string(m[1])
+	return nil
 }
 
 type spdxDocument struct {
@@ -216,6 +573,9 @@ type spdxDocument struct {
 	FilesByID    map[spdx_common.ElementID]*spdx.File
 
 	RelationshipsByPackageID map[spdx_common.ElementID][]*spdx.Relationship
+
+	// Digest is the digest of the encoded document.
+	Digest digest.Digest
 }
 
 func newSPDXWrapper(doc *spdx.Document) spdxDocument {
@@ -0,0 +1,434 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSBOMEcosystems(t *testing.T) {
+	t.Parallel()
+
+	purls := []string{
+		"pkg:apk/alpine/musl@1.2.3-r4",
+		"pkg:deb/debian/libc6@2.31-13?arch=amd64",
+		"pkg:rpm/redhat/openssl@1.1.1k",
+		"pkg:golang/github.com/pkg/errors@v0.9.1",
+		"pkg:npm/lodash@4.17.21",
+		"pkg:pypi/requests@2.28.1",
+		"pkg:maven/org.apache.commons/commons-lang3@3.12.0",
+		"pkg:gem/rails@7.0.4",
+		"pkg:cargo/serde@1.0.147",
+		"pkg:nuget/Newtonsoft.Json@13.0.1",
+		"pkg:composer/laravel/framework@9.0.0",
+		"pkg:generic/openssl@3.0.7",
+		"pkg:swift/github.com/apple/swift-nio@2.0.0",
+		"not a purl",
+	}
+
+	var pkgs []string
+	for i, purl := range purls {
+		// both spellings of the category are used by SPDX generators
+		category := "PACKAGE_MANAGER"
+		if i%2 == 1 {
+			category = "PACKAGE-MANAGER"
+		}
+		pkgs = append(pkgs, fmt.Sprintf(`{
+      "name": "pkg%d",
+      "SPDXID": "SPDXRef-Package-%d",
+      "downloadLocation": "NOASSERTION",
+      "externalRefs": [
+        {
+          "referenceCategory": %q,
+          "referenceType": "purl",
+          "referenceLocator": %q
+        }
+      ]
+    }`, i, i, category, purl))
+	}
+	pkgs = append(pkgs, `{
+      "name": "norefs",
+      "SPDXID": "SPDXRef-Package-norefs",
+      "downloadLocation": "NOASSERTION"
+    }`)
+
+	doc, err := decodeSPDX([]byte(`{
+  "spdxVersion": "SPDX-2.3",
+  "dataLicense": "CC0-1.0",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "name": "test",
+  "documentNamespace": "https://example.com/test",
+  "creationInfo": {
+    "created": "2022-11-22T10:00:00Z",
+    "creators": ["Tool: test"]
+  },
+  "packages": [` + strings.Join(pkgs, ",") + `]
+}`))
+	require.NoError(t, err)
+
+	var img Image
+	addSPDX(&img, doc, nil)
+
+	sbom := img.SBOM
+	for i, list := range [][]Package{
+		sbom.AlpinePackages,
+		sbom.DebianPackages,
+		sbom.RPMPackages,
+		sbom.GoPackages,
+		sbom.NPMPackages,
+		sbom.PyPIPackages,
+		sbom.MavenPackages,
+		sbom.GemPackages,
+		sbom.CargoPackages,
+		sbom.NuGetPackages,
+		sbom.ComposerPackages,
+		sbom.GenericPackages,
+	} {
+		require.Len(t, list, 1, purls[i])
+		require.Equal(t, fmt.Sprintf("pkg%d", i), list[0].Name)
+		require.NotNil(t, list[0].PURL)
+		require.Equal(t, purls[i], list[0].PURL.String())
+	}
+
+	require.Len(t, sbom.UnknownPackages, 3)
+	require.Equal(t, "swift", sbom.UnknownPackages[0].PURL.Type)
+	require.Nil(t, sbom.UnknownPackages[1].PURL)
+	require.Nil(t, sbom.UnknownPackages[2].PURL)
+
+	deb := sbom.DebianPackages[0].PURL
+	require.Equal(t, "debian", deb.Namespace)
+	require.Equal(t, "libc6", deb.Name)
+	require.Equal(t, "2.31-13", deb.Version)
+	require.Equal(t, map[string]string{"arch": "amd64"}, deb.Qualifiers)
+}
+
+const testSPDXTagValue = `SPDXVersion: SPDX-2.2
+DataLicense: CC0-1.0
+SPDXID: SPDXRef-DOCUMENT
+DocumentName: test
+DocumentNamespace: https://example.com/test
+Creator: Tool: test
+Created: 2022-11-22T10:00:00Z
+
+PackageName: curl
+SPDXID: SPDXRef-Package-curl
+PackageVersion: 7.74.0-1.3
+PackageDownloadLocation: NOASSERTION
+PackageLicenseConcluded: curl
+ExternalRef: PACKAGE-MANAGER purl pkg:deb/debian/curl@7.74.0-1.3
+`
+
+const testSPDXYAML = `spdxVersion: SPDX-2.3
+dataLicense: CC0-1.0
+SPDXID: SPDXRef-DOCUMENT
+name: test
+documentNamespace: https://example.com/test
+creationInfo:
+  created: "2022-11-22T10:00:00Z"
+  creators:
+    - "Tool: test"
+packages:
+  - name: curl
+    SPDXID: SPDXRef-Package-curl
+    versionInfo: 7.74.0-1.3
+    downloadLocation: NOASSERTION
+    licenseConcluded: curl
+    externalRefs:
+      - referenceCategory: PACKAGE-MANAGER
+        referenceType: purl
+        referenceLocator: pkg:deb/debian/curl@7.74.0-1.3
+`
+
+func TestDecodeSPDX(t *testing.T) {
+	t.Parallel()
+
+	quoted, err := json.Marshal(testSPDXTagValue)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name string
+		dt   string
+	}{
+		{
+			name: "json 2.3",
+			dt:   testSPDX,
+		},
+		{
+			name: "yaml",
+			dt:   testSPDXYAML,
+		},
+		{
+			name: "tag-value",
+			dt:   testSPDXTagValue,
+		},
+		{
+			name: "string",
+			dt:   string(quoted),
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := decodeSPDX([]byte(tc.dt))
+			require.NoError(t, err)
+			require.Len(t, doc.Packages, 1)
+
+			var img Image
+			addSPDX(&img, doc, nil)
+
+			pkgs := append(img.SBOM.AlpinePackages, img.SBOM.DebianPackages...)
+			require.Len(t, pkgs, 1)
+			require.NotNil(t, pkgs[0].PURL)
+			require.Equal(t, pkgs[0].Name, pkgs[0].PURL.Name)
+		})
+	}
+
+	_, err = decodeSPDX([]byte(strings.Replace(testSPDX, "SPDX-2.3", "SPDX-3.0", 1)))
+	require.ErrorContains(t, err, "unsupported spdx version")
+
+	_, err = decodeSPDX([]byte(`"not a document"`))
+	require.Error(t, err)
+}
+
+// testSPDX22 is an SPDX 2.2 document as generated by syft for an alpine
+// image, trimmed to two packages.
+const testSPDX22 = `{
+ "SPDXID": "SPDXRef-DOCUMENT",
+ "name": "alpine-latest",
+ "spdxVersion": "SPDX-2.2",
+ "creationInfo": {
+  "created": "2022-11-22T10:00:00Z",
+  "creators": [
+   "Organization: Anchore, Inc",
+   "Tool: syft-0.62.1"
+  ],
+  "licenseListVersion": "3.19"
+ },
+ "dataLicense": "CC0-1.0",
+ "documentNamespace": "https://anchore.com/syft/image/alpine-latest-7ba8cc68-5ab3-4f1e-a8b1-e2a7c9b3f30c",
+ "packages": [
+  {
+   "SPDXID": "SPDXRef-a3a8ac1e22a3d1f2",
+   "name": "busybox",
+   "licenseConcluded": "GPL-2.0-only",
+   "description": "Size optimized toolbox of many common UNIX utilities",
+   "downloadLocation": "https://busybox.net/",
+   "externalRefs": [
+    {
+     "referenceCategory": "SECURITY",
+     "referenceLocator": "cpe:2.3:a:busybox:busybox:1.35.0-r29:*:*:*:*:*:*:*",
+     "referenceType": "cpe23Type"
+    },
+    {
+     "referenceCategory": "PACKAGE_MANAGER",
+     "referenceLocator": "pkg:apk/alpine/busybox@1.35.0-r29?arch=x86_64&upstream=busybox&distro=alpine-3.17.0",
+     "referenceType": "purl"
+    }
+   ],
+   "filesAnalyzed": false,
+   "homepage": "https://busybox.net/",
+   "licenseDeclared": "GPL-2.0-only",
+   "originator": "Person: Sören Tempel <soeren+alpine@soeren-tempel.net>",
+   "sourceInfo": "acquired package info from APK DB: /lib/apk/db/installed",
+   "versionInfo": "1.35.0-r29"
+  },
+  {
+   "SPDXID": "SPDXRef-5e3b7a6d4c8f2b19",
+   "name": "musl",
+   "licenseConcluded": "MIT",
+   "description": "the musl c library (libc) implementation",
+   "downloadLocation": "https://musl.libc.org/",
+   "externalRefs": [
+    {
+     "referenceCategory": "SECURITY",
+     "referenceLocator": "cpe:2.3:a:musl-libc:musl:1.2.3-r4:*:*:*:*:*:*:*",
+     "referenceType": "cpe23Type"
+    },
+    {
+     "referenceCategory": "PACKAGE_MANAGER",
+     "referenceLocator": "pkg:apk/alpine/musl@1.2.3-r4?arch=x86_64&upstream=musl&distro=alpine-3.17.0",
+     "referenceType": "purl"
+    }
+   ],
+   "filesAnalyzed": false,
+   "homepage": "https://musl.libc.org/",
+   "licenseDeclared": "MIT",
+   "originator": "Person: Timo Teräs <timo.teras@iki.fi>",
+   "sourceInfo": "acquired package info from APK DB: /lib/apk/db/installed",
+   "versionInfo": "1.2.3-r4"
+  }
+ ],
+ "files": [
+  {
+   "SPDXID": "SPDXRef-1c6f2b0a8d7e4f35",
+   "comment": "layerID: sha256:ded7a220bb058e28ee3254fbba04ca90b679070424424761a53a043b93b612bf",
+   "licenseConcluded": "NOASSERTION",
+   "fileName": "/bin/busybox",
+   "copyrightText": "",
+   "checksums": [
+    {
+     "algorithm": "SHA1",
+     "checksumValue": "0000000000000000000000000000000000000000"
+    }
+   ]
+  }
+ ],
+ "relationships": [
+  {
+   "spdxElementId": "SPDXRef-DOCUMENT",
+   "relationshipType": "DESCRIBES",
+   "relatedSpdxElement": "SPDXRef-a3a8ac1e22a3d1f2"
+  },
+  {
+   "spdxElementId": "SPDXRef-a3a8ac1e22a3d1f2",
+   "relationshipType": "CONTAINS",
+   "relatedSpdxElement": "SPDXRef-1c6f2b0a8d7e4f35"
+  },
+  {
+   "spdxElementId": "SPDXRef-5e3b7a6d4c8f2b19",
+   "relationshipType": "DEPENDENCY_OF",
+   "relatedSpdxElement": "SPDXRef-a3a8ac1e22a3d1f2"
+  }
+ ]
+}`
+
+func TestDecodeSPDX22(t *testing.T) {
+	t.Parallel()
+
+	doc, err := decodeSPDX([]byte(testSPDX22))
+	require.NoError(t, err)
+	require.Len(t, doc.Packages, 2)
+
+	var img Image
+	addSPDX(&img, doc, nil)
+
+	sbom := img.SBOM
+	require.NotNil(t, sbom)
+	require.Equal(t, []SBOMDocument{{
+		ID:     "https://anchore.com/syft/image/alpine-latest-7ba8cc68-5ab3-4f1e-a8b1-e2a7c9b3f30c",
+		Format: SBOMFormatSPDX,
+		Name:   "alpine-latest",
+	}}, sbom.Documents)
+
+	require.Len(t, sbom.AlpinePackages, 2)
+	busybox, musl := sbom.AlpinePackages[0], sbom.AlpinePackages[1]
+
+	require.Equal(t, "busybox", busybox.Name)
+	require.Equal(t, "1.35.0-r29", busybox.Version)
+	require.Equal(t, "Size optimized toolbox of many common UNIX utilities", busybox.Description)
+	require.Equal(t, "https://busybox.net/", busybox.HomepageURL)
+	require.Equal(t, []string{"GPL-2.0-only"}, busybox.License)
+	require.Equal(t, "Sören Tempel <soeren+alpine@soeren-tempel.net>", busybox.Creator.Name)
+	require.Equal(t, []string{"/bin/busybox"}, busybox.Files)
+	require.Equal(t, []string{"cpe:2.3:a:busybox:busybox:1.35.0-r29:*:*:*:*:*:*:*"}, busybox.CPEs)
+	require.NotNil(t, busybox.PURL)
+	require.Equal(t, "alpine", busybox.PURL.Namespace)
+	require.Equal(t, "busybox", busybox.PURL.Name)
+	require.Equal(t, "x86_64", busybox.PURL.Qualifiers["arch"])
+	require.Equal(t, busybox.PURL.String(), busybox.ID)
+
+	require.Equal(t, "musl", musl.Name)
+	require.Equal(t, "1.2.3-r4", musl.Version)
+	require.NotNil(t, musl.PURL)
+	require.Empty(t, musl.Files)
+
+	// the DEPENDENCY_OF relationship is reversed into a dependency of busybox
+	require.Equal(t, []string{musl.ID}, busybox.Dependencies)
+	require.Empty(t, musl.Dependencies)
+
+	// relationships with files aren't kept
+	require.Equal(t, []Relationship{
+		{From: sbom.Documents[0].ID, Type: RelationshipDescribes, To: busybox.ID},
+		{From: musl.ID, Type: "DEPENDENCY_OF", To: busybox.ID},
+	}, sbom.Relationships)
+}
+
+func TestMergeSBOM(t *testing.T) {
+	t.Parallel()
+
+	spdxDoc, err := decodeSPDX([]byte(testSPDXYAML))
+	require.NoError(t, err)
+
+	// the same document is attached twice, such as through an attestation
+	// manifest and a referrer
+	spdxDup, err := decodeSPDX([]byte(testSPDXYAML))
+	require.NoError(t, err)
+
+	bom, err := decodeCycloneDX([]byte(`{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.4",
+  "serialNumber": "urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79",
+  "components": [
+    {
+      "type": "library",
+      "name": "curl",
+      "version": "7.74.0-1.3",
+      "description": "command line tool for transferring data with URL syntax",
+      "licenses": [{"license": {"id": "curl"}}, {"license": {"id": "MIT"}}],
+      "purl": "pkg:deb/debian/curl@7.74.0-1.3",
+      "cpe": "cpe:2.3:a:haxx:curl:7.74.0:*:*:*:*:*:*:*"
+    },
+    {
+      "type": "library",
+      "name": "curl",
+      "version": "7.88.1-10",
+      "purl": "pkg:deb/debian/curl@7.88.1-10"
+    }
+  ]
+}`))
+	require.NoError(t, err)
+
+	sigs := []Signature{
+		{Type: SignatureTypeDSSE, Verified: true, Identity: Identity{KeyID: "a"}},
+		{Type: SignatureTypeDSSE, Verified: true, Identity: Identity{KeyID: "b"}},
+	}
+
+	var img Image
+	addSPDX(&img, spdxDoc, sigs[:1])
+	addSPDX(&img, spdxDup, sigs[1:])
+	addCycloneDX(&img, bom, nil)
+	normalizeSBOM(img.SBOM)
+
+	// signatures stay with the document they were read from
+	require.Equal(t, []SBOMDocument{
+		{ID: "https://example.com/test", Format: SBOMFormatSPDX, Name: "test", Signatures: sigs},
+		{ID: "urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79", Format: SBOMFormatCycloneDX},
+	}, img.SBOM.Documents)
+
+	pkgs := img.SBOM.DebianPackages
+	require.Len(t, pkgs, 2)
+
+	curl := pkgs[0]
+	require.Equal(t, "pkg:deb/debian/curl@7.74.0-1.3", curl.ID)
+	require.Equal(t, []string{"curl", "MIT"}, curl.License)
+	require.Equal(t, "command line tool for transferring data with URL syntax", curl.Description)
+	require.Equal(t, []string{"cpe:2.3:a:haxx:curl:7.74.0:*:*:*:*:*:*:*"}, curl.CPEs)
+	require.Equal(t, []string{"https://example.com/test", "urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79"}, curl.Sources)
+
+	require.Equal(t, "7.88.1-10", pkgs[1].Version)
+	require.Equal(t, []string{"urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79"}, pkgs[1].Sources)
+
+	// merging is idempotent as SBOMs are normalized after each attestation
+	normalizeSBOM(img.SBOM)
+	require.Equal(t, pkgs, img.SBOM.DebianPackages)
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/cryptobyte"
+	casn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// oidSCTList is the X.509 extension holding the signed certificate
+// timestamps embedded in a certificate.
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// signedCertificateTimestamp is a v1 SCT, as defined in
+// https://datatracker.ietf.org/doc/html/rfc6962#section-3.2
+type signedCertificateTimestamp struct {
+	logID      []byte
+	timestamp  uint64
+	extensions []byte
+	signature  []byte
+}
+
+// verifySCT checks that leaf embeds a signed certificate timestamp from one
+// of the certificate transparency logs of the trusted root, issued while the
+// log was valid. issuer is the certificate that signed leaf. Certificates are
+// not checked if the trusted root has no certificate transparency logs.
+func (tr *TrustedRoot) verifySCT(leaf, issuer *x509.Certificate) error {
+	if len(tr.ctlogs) == 0 {
+		return nil
+	}
+
+	var ext []byte
+	for _, e := range leaf.Extensions {
+		if e.Id.Equal(oidSCTList) {
+			ext = e.Value
+		}
+	}
+	if ext == nil {
+		return errors.New("signing certificate has no signed certificate timestamp")
+	}
+
+	scts, err := parseSCTList(ext)
+	if err != nil {
+		return err
+	}
+	tbs, err := precertTBS(leaf)
+	if err != nil {
+		return err
+	}
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+
+	var lastErr error = errors.New("no signed certificate timestamp from a trusted certificate transparency log")
+	for _, sct := range scts {
+		logID := hex.EncodeToString(sct.logID)
+		ctlog, ok := tr.ctlogs[logID]
+		if !ok {
+			continue
+		}
+		if !ctlog.validFor.contains(time.UnixMilli(int64(sct.timestamp))) {
+			lastErr = errors.Errorf("certificate transparency log %s not valid at timestamp", logID)
+			continue
+		}
+		if err := verifySignature(ctlog.key, sct.signedData(issuerKeyHash[:], tbs), sct.signature); err != nil {
+			lastErr = errors.Wrap(err, "failed to verify signed certificate timestamp")
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// signedData returns the data signed by the log for a precertificate entry.
+func (sct signedCertificateTimestamp) signedData(issuerKeyHash, tbs []byte) []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(0) // v1
+	b.AddUint8(0) // certificate_timestamp
+	b.AddUint64(sct.timestamp)
+	b.AddUint16(1) // precert_entry
+	b.AddBytes(issuerKeyHash)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(tbs)
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.extensions)
+	})
+	return b.BytesOrPanic()
+}
+
+// parseSCTList parses the value of the SCT list extension. SCTs of unknown
+// versions are skipped.
+func parseSCTList(ext []byte) ([]signedCertificateTimestamp, error) {
+	var dt []byte
+	if rest, err := asn1.Unmarshal(ext, &dt); err != nil || len(rest) > 0 {
+		return nil, errors.New("malformed signed certificate timestamp list")
+	}
+
+	s := cryptobyte.String(dt)
+	var list cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&list) || !s.Empty() {
+		return nil, errors.New("malformed signed certificate timestamp list")
+	}
+
+	var scts []signedCertificateTimestamp
+	for !list.Empty() {
+		var raw, extensions, sig cryptobyte.String
+		var version, hashAlg, sigAlg uint8
+		var sct signedCertificateTimestamp
+		if !list.ReadUint16LengthPrefixed(&raw) ||
+			!raw.ReadUint8(&version) ||
+			!raw.ReadBytes(&sct.logID, 32) ||
+			!raw.ReadUint64(&sct.timestamp) ||
+			!raw.ReadUint16LengthPrefixed(&extensions) ||
+			!raw.ReadUint8(&hashAlg) ||
+			!raw.ReadUint8(&sigAlg) ||
+			!raw.ReadUint16LengthPrefixed(&sig) ||
+			!raw.Empty() {
+			return nil, errors.New("malformed signed certificate timestamp")
+		}
+		// only v1 SCTs signed over sha256 are supported
+		if version != 0 || hashAlg != 4 {
+			continue
+		}
+		sct.extensions = extensions
+		sct.signature = sig
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// precertTBS returns the TBSCertificate of cert without the SCT list
+// extension, which is what the log signed.
+func precertTBS(cert *x509.Certificate) ([]byte, error) {
+	input := cryptobyte.String(cert.RawTBSCertificate)
+	var tbs cryptobyte.String
+	if !input.ReadASN1(&tbs, casn1.SEQUENCE) {
+		return nil, errors.New("malformed certificate")
+	}
+
+	extensionsTag := casn1.Tag(3).Constructed().ContextSpecific()
+
+	var b cryptobyte.Builder
+	b.AddASN1(casn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !tbs.Empty() {
+			var elem cryptobyte.String
+			var tag casn1.Tag
+			if !tbs.ReadAnyASN1Element(&elem, &tag) {
+				b.SetError(errors.New("malformed certificate"))
+				return
+			}
+			if tag != extensionsTag {
+				b.AddBytes(elem)
+				continue
+			}
+
+			var wrapper, exts cryptobyte.String
+			if !elem.ReadASN1(&wrapper, extensionsTag) || !wrapper.ReadASN1(&exts, casn1.SEQUENCE) {
+				b.SetError(errors.New("malformed certificate extensions"))
+				return
+			}
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(casn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					for !exts.Empty() {
+						var ext, body cryptobyte.String
+						var id asn1.ObjectIdentifier
+						if !exts.ReadASN1Element(&ext, casn1.SEQUENCE) {
+							b.SetError(errors.New("malformed certificate extension"))
+							return
+						}
+						e := ext
+						if !e.ReadASN1(&body, casn1.SEQUENCE) || !body.ReadASN1ObjectIdentifier(&id) {
+							b.SetError(errors.New("malformed certificate extension"))
+							return
+						}
+						if !id.Equal(oidSCTList) {
+							b.AddBytes(ext)
+						}
+					}
+				})
+			})
+		}
+	})
+	return b.Bytes()
+}
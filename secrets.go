@@ -0,0 +1,162 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+type SecretType string
+
+const (
+	SecretPrivateKey        SecretType = "private-key"
+	SecretAWSCredentials    SecretType = "aws-credentials"
+	SecretNPMToken          SecretType = "npm-token"
+	SecretPyPICredentials   SecretType = "pypi-credentials"
+	SecretDockerCredentials SecretType = "docker-credentials"
+	SecretNetrcCredentials  SecretType = "netrc-credentials"
+	SecretGitDirectory      SecretType = "git-directory"
+)
+
+// Secret is a file of a layer that likely contains a secret.
+type Secret struct {
+	Type  SecretType
+	Layer digest.Digest
+	Path  string
+	// Deleted is set when a later layer deleted or replaced the file. It is
+	// then missing from the image filesystem but can still be extracted
+	// from Layer.
+	Deleted bool `json:",omitempty"`
+}
+
+// maxSecretFileSize is the size of the largest files whose content is
+// scanned for secrets.
+const maxSecretFileSize = 1 << 20
+
+type secretRule struct {
+	typ SecretType
+	// suffix is the end of the path of the files the rule applies to.
+	suffix string
+	// content matches the files that contain credentials, as these files
+	// are often only used for configuration.
+	content *regexp.Regexp
+}
+
+var secretRules = []secretRule{
+	{SecretAWSCredentials, "/.aws/credentials", regexp.MustCompile(`(?im)^\s*aws_secret_access_key\s*=\s*\S`)},
+	{SecretNPMToken, "/.npmrc", regexp.MustCompile(`(?m)(_authToken|_auth|_password)\s*=\s*\S`)},
+	{SecretPyPICredentials, "/.pypirc", regexp.MustCompile(`(?m)^\s*password\s*[=:]\s*\S`)},
+	{SecretDockerCredentials, "/.docker/config.json", regexp.MustCompile(`"auth"\s*:\s*"[^"]+"`)},
+	{SecretNetrcCredentials, "/.netrc", regexp.MustCompile(`\bpassword\s+\S`)},
+}
+
+var privateKeyPattern = regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----\r?\n`)
+
+// secretScanner looks for secrets in the files of a layer.
+type secretScanner struct {
+	layer   digest.Digest
+	git     map[string]struct{}
+	secrets []Secret
+}
+
+func newSecretScanner(layer digest.Digest) *secretScanner {
+	return &secretScanner{
+		layer: layer,
+		git:   make(map[string]struct{}),
+	}
+}
+
+func (s *secretScanner) scan(f File, r io.Reader) error {
+	if f.Whiteout {
+		return nil
+	}
+
+	if dir := gitDir(f.Path); dir != "" {
+		if _, ok := s.git[dir]; !ok {
+			s.git[dir] = struct{}{}
+			s.add(SecretGitDirectory, dir)
+		}
+		return nil
+	}
+
+	if !f.Mode.IsRegular() || f.Size == 0 || f.Size > maxSecretFileSize {
+		return nil
+	}
+
+	dt, err := io.ReadAll(io.LimitReader(r, maxSecretFileSize))
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range secretRules {
+		if strings.HasSuffix(f.Path, rule.suffix) && rule.content.Match(dt) {
+			s.add(rule.typ, f.Path)
+			return nil
+		}
+	}
+
+	// binaries such as TLS libraries contain the PEM markers as well
+	if bytes.IndexByte(dt, 0) < 0 && privateKeyPattern.Match(dt) {
+		s.add(SecretPrivateKey, f.Path)
+	}
+	return nil
+}
+
+func (s *secretScanner) add(typ SecretType, p string) {
+	s.secrets = append(s.secrets, Secret{
+		Type:  typ,
+		Layer: s.layer,
+		Path:  p,
+	})
+}
+
+// gitDir returns the path of the .git directory p is in, if any.
+func gitDir(p string) string {
+	i := strings.Index(p+"/", "/.git/")
+	if i < 0 {
+		return ""
+	}
+	return p[:i+len("/.git")]
+}
+
+// markDeleted sets Deleted for the secrets that aren't part of the image
+// filesystem files, sorted by path.
+func markDeleted(secrets []Secret, files []File) {
+	for i, s := range secrets {
+		j := sort.Search(len(files), func(j int) bool {
+			return files[j].Path >= s.Path
+		})
+		if s.Type == SecretGitDirectory {
+			// directories are only deleted along with their content
+			secrets[i].Deleted = !(j < len(files) && files[j].Path == s.Path) && !hasChildren(files, s.Path)
+			continue
+		}
+		secrets[i].Deleted = j == len(files) || files[j].Path != s.Path || files[j].Layer != s.Layer
+	}
+}
+
+func hasChildren(files []File, dir string) bool {
+	prefix := dir + "/"
+	i := sort.Search(len(files), func(i int) bool {
+		return files[i].Path >= prefix
+	})
+	return i < len(files) && strings.HasPrefix(files[i].Path, prefix)
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// ParsePublicKeys parses all PEM encoded ECDSA, RSA and Ed25519 public keys
+// in dt.
+func ParsePublicKeys(dt []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, dt = pem.Decode(dt)
+		if block == nil {
+			break
+		}
+
+		var pub crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse public key")
+		}
+
+		switch pub.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, errors.Errorf("unsupported public key type %T", pub)
+		}
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return keys, nil
+}
+
+type publicKey struct {
+	key crypto.PublicKey
+	pem string
+}
+
+func newPublicKeys(keys []crypto.PublicKey) ([]publicKey, error) {
+	out := make([]publicKey, len(keys))
+	for i, key := range keys {
+		dt, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid public key")
+		}
+		out[i] = publicKey{
+			key: key,
+			pem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: dt})),
+		}
+	}
+	return out, nil
+}
+
+// errNoMatchingKey is recorded on signatures that none of the configured
+// public keys verify.
+const errNoMatchingKey = "signature does not match any public key"
+
+// verifyWithKeys verifies sig over payload with each of the keys and returns
+// the first key that matches.
+func verifyWithKeys(keys []publicKey, payload, sig []byte) (*publicKey, bool) {
+	for i := range keys {
+		if verifySignature(keys[i].key, payload, sig) == nil {
+			return &keys[i], true
+		}
+	}
+	return nil, false
+}
+
+func verifySignature(pub crypto.PublicKey, payload, sig []byte) error {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		for _, h := range []crypto.Hash{curveHash(pub.Curve), crypto.SHA256} {
+			if ecdsa.VerifyASN1(pub, hashPayload(h, payload), sig) {
+				return nil
+			}
+		}
+		return errors.New("invalid ecdsa signature")
+	case *rsa.PublicKey:
+		digest := hashPayload(crypto.SHA256, payload)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig); err == nil {
+			return nil
+		}
+		return rsa.VerifyPSS(pub, crypto.SHA256, digest, sig, nil)
+	case ed25519.PublicKey:
+		if ed25519.Verify(pub, payload, sig) {
+			return nil
+		}
+		return errors.New("invalid ed25519 signature")
+	}
+	return errors.Errorf("unsupported public key type %T", pub)
+}
+
+func curveHash(curve elliptic.Curve) crypto.Hash {
+	switch curve {
+	case elliptic.P384():
+		return crypto.SHA384
+	case elliptic.P521():
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+func hashPayload(h crypto.Hash, payload []byte) []byte {
+	hh := h.New()
+	hh.Write(payload)
+	return hh.Sum(nil)
+}
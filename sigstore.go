@@ -0,0 +1,865 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const MediaTypeSigstoreBundlePrefix = "application/vnd.dev.sigstore.bundle"
+
+var (
+	// oidIssuer is the Fulcio extension holding the OIDC issuer as raw
+	// bytes, oidIssuerV2 holds it as a DER encoded UTF8String.
+	oidIssuer   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+	// oidOtherName is the type of the Fulcio otherName SAN, used for
+	// usernames.
+	oidOtherName      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 7}
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+)
+
+// TrustedRoot holds the certificate authorities and transparency logs used
+// to verify keyless sigstore signatures offline.
+//
+// A signature is verified if its certificate chains up to a certificate
+// authority, embeds a signed certificate timestamp from one of the
+// certificate transparency logs (if the trusted root lists any), and its
+// transparency log entry has a valid signed entry timestamp and, if present,
+// inclusion proof and checkpoint. The time of the signed entry timestamp is
+// the only trusted signing time: RFC 3161 timestamps from timestamp
+// authorities are not verified, so entries with only an inclusion proof are
+// rejected. Certificate revocation and the identity policy of the signer
+// aren't checked; callers should match the returned Identity.
+type TrustedRoot struct {
+	cas    []certificateAuthority
+	tlogs  map[string]transparencyLog
+	ctlogs map[string]transparencyLog
+}
+
+type certificateAuthority struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	validFor      validity
+}
+
+type transparencyLog struct {
+	key      crypto.PublicKey
+	validFor validity
+}
+
+type validity struct {
+	start time.Time
+	end   time.Time
+}
+
+func (v validity) contains(t time.Time) bool {
+	if !v.start.IsZero() && t.Before(v.start) {
+		return false
+	}
+	if !v.end.IsZero() && t.After(v.end) {
+		return false
+	}
+	return true
+}
+
+// trustedRootJSON is the JSON serialization of the sigstore TrustedRoot
+// message, as found in trusted_root.json.
+type trustedRootJSON struct {
+	MediaType              string                `json:"mediaType"`
+	Tlogs                  []transparencyLogJSON `json:"tlogs"`
+	Ctlogs                 []transparencyLogJSON `json:"ctlogs"`
+	CertificateAuthorities []struct {
+		CertChain struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"certChain"`
+		ValidFor validityJSON `json:"validFor"`
+	} `json:"certificateAuthorities"`
+}
+
+type transparencyLogJSON struct {
+	PublicKey struct {
+		RawBytes []byte       `json:"rawBytes"`
+		ValidFor validityJSON `json:"validFor"`
+	} `json:"publicKey"`
+	LogID struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+}
+
+type validityJSON struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ParseTrustedRoot parses a sigstore trusted root, as distributed in
+// trusted_root.json by the sigstore TUF repository.
+func ParseTrustedRoot(dt []byte) (*TrustedRoot, error) {
+	var trj trustedRootJSON
+	if err := json.Unmarshal(dt, &trj); err != nil {
+		return nil, errors.Wrap(err, "failed to decode trusted root")
+	}
+
+	tr := &TrustedRoot{
+		tlogs:  map[string]transparencyLog{},
+		ctlogs: map[string]transparencyLog{},
+	}
+
+	for _, ca := range trj.CertificateAuthorities {
+		c := certificateAuthority{
+			roots:         x509.NewCertPool(),
+			intermediates: x509.NewCertPool(),
+			validFor:      validity{start: ca.ValidFor.Start, end: ca.ValidFor.End},
+		}
+		for _, raw := range ca.CertChain.Certificates {
+			cert, err := x509.ParseCertificate(raw.RawBytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to parse certificate authority")
+			}
+			if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+				c.roots.AddCert(cert)
+			} else {
+				c.intermediates.AddCert(cert)
+			}
+		}
+		tr.cas = append(tr.cas, c)
+	}
+
+	if err := addTransparencyLogs(tr.tlogs, trj.Tlogs); err != nil {
+		return nil, errors.Wrap(err, "failed to parse transparency log key")
+	}
+	if err := addTransparencyLogs(tr.ctlogs, trj.Ctlogs); err != nil {
+		return nil, errors.Wrap(err, "failed to parse certificate transparency log key")
+	}
+
+	if len(tr.cas) == 0 {
+		return nil, errors.New("trusted root has no certificate authorities")
+	}
+	if len(tr.tlogs) == 0 {
+		return nil, errors.New("trusted root has no transparency logs")
+	}
+	return tr, nil
+}
+
+// addTransparencyLogs adds logs to m, keyed by their hex encoded log ID.
+func addTransparencyLogs(m map[string]transparencyLog, logs []transparencyLogJSON) error {
+	for _, tlog := range logs {
+		key, err := x509.ParsePKIXPublicKey(tlog.PublicKey.RawBytes)
+		if err != nil {
+			return err
+		}
+		logID := tlog.LogID.KeyID
+		if len(logID) == 0 {
+			h := sha256.Sum256(tlog.PublicKey.RawBytes)
+			logID = h[:]
+		}
+		m[hex.EncodeToString(logID)] = transparencyLog{
+			key:      key,
+			validFor: validity{start: tlog.PublicKey.ValidFor.Start, end: tlog.PublicKey.ValidFor.End},
+		}
+	}
+	return nil
+}
+
+// keylessMaterial is the verification material of a keyless signature.
+type keylessMaterial struct {
+	certs   []*x509.Certificate // leaf first
+	entries []tlogEntry
+}
+
+type tlogEntry struct {
+	logIndex       int64
+	logID          string // hex
+	integratedTime int64
+	body           []byte
+	set            []byte
+	proof          *inclusionProof
+}
+
+type inclusionProof struct {
+	logIndex   int64
+	treeSize   int64
+	rootHash   []byte
+	hashes     [][]byte
+	checkpoint string
+}
+
+// verify checks that the signing certificate chains up to a trusted
+// certificate authority at the time the signature was logged in a trusted
+// transparency log. verifySig checks the signature with the certificate key
+// and checkBody that the log entry is for the signature.
+func (tr *TrustedRoot) verify(m keylessMaterial, verifySig func(crypto.PublicKey) error, checkBody func([]byte) error) (*Identity, error) {
+	if len(m.certs) == 0 {
+		return nil, errors.New("no signing certificate")
+	}
+	leaf := m.certs[0]
+
+	var entry *tlogEntry
+	var signedAt time.Time
+	var lastErr error = errors.New("no transparency log entry")
+	for i := range m.entries {
+		t, err := tr.verifyEntry(m.entries[i])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := checkBody(m.entries[i].body); err != nil {
+			lastErr = err
+			continue
+		}
+		entry, signedAt = &m.entries[i], t
+		break
+	}
+	if entry == nil {
+		return nil, lastErr
+	}
+
+	// the otherName SAN is marked critical as it is the only SAN, but it
+	// isn't handled by crypto/x509
+	username := otherName(leaf)
+	if username != "" {
+		var unhandled []asn1.ObjectIdentifier
+		for _, oid := range leaf.UnhandledCriticalExtensions {
+			if !oid.Equal(oidSubjectAltName) {
+				unhandled = append(unhandled, oid)
+			}
+		}
+		leaf.UnhandledCriticalExtensions = unhandled
+	}
+
+	issuer, err := tr.verifyCertificate(m.certs, signedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tr.verifySCT(leaf, issuer); err != nil {
+		return nil, err
+	}
+
+	if err := verifySig(leaf.PublicKey); err != nil {
+		return nil, err
+	}
+
+	id := &Identity{
+		LogIndex: entry.logIndex,
+	}
+	if len(leaf.EmailAddresses) > 0 {
+		id.Subject = leaf.EmailAddresses[0]
+	} else if len(leaf.URIs) > 0 {
+		id.Subject = leaf.URIs[0].String()
+	} else {
+		id.Subject = username
+	}
+	for _, ext := range leaf.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				id.Issuer = issuer
+			}
+		case ext.Id.Equal(oidIssuer) && id.Issuer == "":
+			id.Issuer = string(ext.Value)
+		}
+	}
+	return id, nil
+}
+
+// otherName returns the value of the Fulcio otherName SAN of cert.
+func otherName(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var names asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+			return ""
+		}
+		rest := names.Bytes
+		for len(rest) > 0 {
+			var name asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &name); err != nil {
+				return ""
+			}
+			// otherName [0] IMPLICIT SEQUENCE { type-id, [0] EXPLICIT value }
+			if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+				continue
+			}
+			var on struct {
+				ID    asn1.ObjectIdentifier
+				Value string `asn1:"utf8,explicit,tag:0"`
+			}
+			if _, err := asn1.UnmarshalWithParams(name.FullBytes, &on, "tag:0"); err == nil && on.ID.Equal(oidOtherName) {
+				return on.Value
+			}
+		}
+	}
+	return ""
+}
+
+// verifyCertificate verifies the chain of the leaf certificate of certs at
+// time t and returns the certificate that issued it.
+func (tr *TrustedRoot) verifyCertificate(certs []*x509.Certificate, t time.Time) (*x509.Certificate, error) {
+	var lastErr error = errors.New("no certificate authority valid at signing time")
+	for _, ca := range tr.cas {
+		if !ca.validFor.contains(t) {
+			continue
+		}
+		intermediates := ca.intermediates.Clone()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+		chains, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         ca.roots,
+			Intermediates: intermediates,
+			CurrentTime:   t,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		})
+		if err == nil {
+			chain := chains[0]
+			if len(chain) == 1 {
+				return chain[0], nil
+			}
+			return chain[1], nil
+		}
+		lastErr = err
+	}
+	return nil, errors.Wrap(lastErr, "failed to verify signing certificate")
+}
+
+// verifyEntry verifies the signed entry timestamp and, if present, the
+// inclusion proof of a transparency log entry and returns the time the entry
+// was integrated into the log. The integrated time is only covered by the
+// signed entry timestamp, so entries without one are rejected.
+func (tr *TrustedRoot) verifyEntry(e tlogEntry) (time.Time, error) {
+	tlog, ok := tr.tlogs[e.logID]
+	if !ok {
+		return time.Time{}, errors.Errorf("unknown transparency log %s", e.logID)
+	}
+	if len(e.set) == 0 {
+		return time.Time{}, errors.New("transparency log entry has no signed entry timestamp")
+	}
+
+	canonical, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{
+		Body:           base64.StdEncoding.EncodeToString(e.body),
+		IntegratedTime: e.integratedTime,
+		LogID:          e.logID,
+		LogIndex:       e.logIndex,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifySignature(tlog.key, canonical, e.set); err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to verify signed entry timestamp")
+	}
+
+	integratedAt := time.Unix(e.integratedTime, 0)
+	if !tlog.validFor.contains(integratedAt) {
+		return time.Time{}, errors.Errorf("transparency log %s not valid at integration time", e.logID)
+	}
+
+	if e.proof != nil {
+		if err := verifyInclusionProof(tlog.key, e); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return integratedAt, nil
+}
+
+// verifyInclusionProof verifies the RFC 6962 inclusion proof of the entry
+// and the signed checkpoint committing to its root hash.
+func verifyInclusionProof(key crypto.PublicKey, e tlogEntry) error {
+	p := e.proof
+	if p.logIndex < 0 || p.logIndex >= p.treeSize {
+		return errors.Errorf("invalid inclusion proof index %d for tree size %d", p.logIndex, p.treeSize)
+	}
+
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(e.body)
+	hash := h.Sum(nil)
+
+	// https://datatracker.ietf.org/doc/html/rfc9162#section-2.1.3.2
+	fn, sn := p.logIndex, p.treeSize-1
+	for _, sibling := range p.hashes {
+		if sn == 0 {
+			return errors.New("inclusion proof too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = hashChildren(sibling, hash)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = hashChildren(hash, sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("inclusion proof too short")
+	}
+	if !bytes.Equal(hash, p.rootHash) {
+		return errors.New("inclusion proof does not match root hash")
+	}
+
+	size, root, err := verifyCheckpoint(key, p.checkpoint)
+	if err != nil {
+		return err
+	}
+	if size != p.treeSize || !bytes.Equal(root, p.rootHash) {
+		return errors.New("checkpoint does not match inclusion proof")
+	}
+	return nil
+}
+
+func hashChildren(l, r []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(l)
+	h.Write(r)
+	return h.Sum(nil)
+}
+
+// verifyCheckpoint verifies a checkpoint in signed note format and returns
+// the tree size and root hash it commits to.
+func verifyCheckpoint(key crypto.PublicKey, checkpoint string) (int64, []byte, error) {
+	i := strings.Index(checkpoint, "\n\n")
+	if i < 0 {
+		return 0, nil, errors.New("malformed checkpoint")
+	}
+	text := checkpoint[:i+1]
+
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) < 3 {
+		return 0, nil, errors.New("malformed checkpoint")
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "malformed checkpoint size")
+	}
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "malformed checkpoint root hash")
+	}
+
+	for _, line := range strings.Split(checkpoint[i+2:], "\n") {
+		if !strings.HasPrefix(line, "— ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		sig, err := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+		if err != nil || len(sig) < 5 {
+			continue
+		}
+		// signatures are prefixed with a 4 byte key hint
+		if verifySignature(key, []byte(text), sig[4:]) == nil {
+			return size, root, nil
+		}
+	}
+	return 0, nil, errors.New("failed to verify checkpoint signature")
+}
+
+// checkRekorBody checks that a hashedrekord, dsse or intoto log entry body
+// records sig over a payload with the given sha256 digest.
+func checkRekorBody(body []byte, payloadDigest []byte, sig []byte) error {
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			// hashedrekord
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content string `json:"content"`
+			} `json:"signature"`
+
+			// dsse
+			PayloadHash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"payloadHash"`
+			Signatures []struct {
+				Signature string `json:"signature"`
+			} `json:"signatures"`
+
+			// intoto
+			Content struct {
+				Envelope struct {
+					Signatures []struct {
+						Sig []byte `json:"sig"`
+					} `json:"signatures"`
+				} `json:"envelope"`
+				PayloadHash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"payloadHash"`
+			} `json:"content"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return errors.Wrap(err, "failed to decode transparency log entry")
+	}
+
+	switch entry.Kind {
+	case "hashedrekord":
+		if entry.Spec.Data.Hash.Algorithm != "sha256" || entry.Spec.Data.Hash.Value != hex.EncodeToString(payloadDigest) {
+			return errors.New("transparency log entry is for a different payload")
+		}
+		logged, err := base64.StdEncoding.DecodeString(entry.Spec.Signature.Content)
+		if err != nil || !bytes.Equal(logged, sig) {
+			return errors.New("transparency log entry is for a different signature")
+		}
+		return nil
+	case "dsse":
+		if entry.Spec.PayloadHash.Algorithm != "sha256" || entry.Spec.PayloadHash.Value != hex.EncodeToString(payloadDigest) {
+			return errors.New("transparency log entry is for a different payload")
+		}
+		for _, s := range entry.Spec.Signatures {
+			if logged, err := decodeBase64(s.Signature); err == nil && bytes.Equal(logged, sig) {
+				return nil
+			}
+		}
+		return errors.New("transparency log entry is for a different signature")
+	case "intoto":
+		// the envelope signatures are base64 encoded twice
+		content := entry.Spec.Content
+		if content.PayloadHash.Algorithm != "sha256" || content.PayloadHash.Value != hex.EncodeToString(payloadDigest) {
+			return errors.New("transparency log entry is for a different payload")
+		}
+		for _, s := range content.Envelope.Signatures {
+			if logged, err := decodeBase64(string(s.Sig)); err == nil && bytes.Equal(logged, sig) {
+				return nil
+			}
+		}
+		return errors.New("transparency log entry is for a different signature")
+	}
+	return errors.Errorf("unsupported transparency log entry kind %q", entry.Kind)
+}
+
+// cosignBundle is the bundle stored by cosign in the
+// dev.sigstore.cosign/bundle annotation.
+type cosignBundle struct {
+	SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+	Payload              struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogIndex       int64  `json:"logIndex"`
+		LogID          string `json:"logID"`
+	} `json:"Payload"`
+}
+
+// cosignKeylessMaterial reads the verification material from the annotations
+// of a cosign signature layer.
+func cosignKeylessMaterial(annotations map[string]string) (*keylessMaterial, error) {
+	certPEM, ok := annotations[AnnotationCosignCertificate]
+	if !ok {
+		return nil, nil
+	}
+
+	certs, err := parseCertificates([]byte(certPEM + "\n" + annotations[AnnotationCosignChain]))
+	if err != nil {
+		return nil, err
+	}
+	m := &keylessMaterial{certs: certs}
+
+	if dt, ok := annotations[AnnotationCosignBundle]; ok {
+		var b cosignBundle
+		if err := json.Unmarshal([]byte(dt), &b); err != nil {
+			return nil, errors.Wrap(err, "failed to decode cosign bundle")
+		}
+		body, err := base64.StdEncoding.DecodeString(b.Payload.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode cosign bundle body")
+		}
+		m.entries = append(m.entries, tlogEntry{
+			logIndex:       b.Payload.LogIndex,
+			logID:          b.Payload.LogID,
+			integratedTime: b.Payload.IntegratedTime,
+			body:           body,
+			set:            b.SignedEntryTimestamp,
+		})
+	}
+	return m, nil
+}
+
+func parseCertificates(dt []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, dt = pem.Decode(dt)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse certificate")
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+// int64String decodes int64 values that protobuf JSON encodes as strings.
+type int64String int64
+
+func (i *int64String) UnmarshalJSON(dt []byte) error {
+	s := strings.Trim(string(dt), `"`)
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = int64String(v)
+	return nil
+}
+
+// sigstoreBundle is the JSON serialization of a sigstore bundle, as defined
+// in https://github.com/sigstore/protobuf-specs.
+type sigstoreBundle struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		Certificate *struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []struct {
+			LogIndex int64String `json:"logIndex"`
+			LogID    struct {
+				KeyID []byte `json:"keyId"`
+			} `json:"logId"`
+			IntegratedTime   int64String `json:"integratedTime"`
+			InclusionPromise *struct {
+				SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+			} `json:"inclusionPromise"`
+			InclusionProof *struct {
+				LogIndex   int64String `json:"logIndex"`
+				RootHash   []byte      `json:"rootHash"`
+				TreeSize   int64String `json:"treeSize"`
+				Hashes     [][]byte    `json:"hashes"`
+				Checkpoint struct {
+					Envelope string `json:"envelope"`
+				} `json:"checkpoint"`
+			} `json:"inclusionProof"`
+			CanonicalizedBody []byte `json:"canonicalizedBody"`
+		} `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+	DSSEEnvelope *dsseEnvelope `json:"dsseEnvelope"`
+}
+
+func (b *sigstoreBundle) material() (*keylessMaterial, error) {
+	vm := b.VerificationMaterial
+
+	m := &keylessMaterial{}
+	var raws [][]byte
+	if vm.Certificate != nil {
+		raws = append(raws, vm.Certificate.RawBytes)
+	}
+	if vm.X509CertificateChain != nil {
+		for _, c := range vm.X509CertificateChain.Certificates {
+			raws = append(raws, c.RawBytes)
+		}
+	}
+	for _, raw := range raws {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse certificate")
+		}
+		m.certs = append(m.certs, cert)
+	}
+
+	for _, e := range vm.TlogEntries {
+		entry := tlogEntry{
+			logIndex:       int64(e.LogIndex),
+			logID:          hex.EncodeToString(e.LogID.KeyID),
+			integratedTime: int64(e.IntegratedTime),
+			body:           e.CanonicalizedBody,
+		}
+		if e.InclusionPromise != nil {
+			entry.set = e.InclusionPromise.SignedEntryTimestamp
+		}
+		if p := e.InclusionProof; p != nil {
+			entry.proof = &inclusionProof{
+				logIndex:   int64(p.LogIndex),
+				treeSize:   int64(p.TreeSize),
+				rootHash:   p.RootHash,
+				hashes:     p.Hashes,
+				checkpoint: p.Checkpoint.Envelope,
+			}
+		}
+		m.entries = append(m.entries, entry)
+	}
+	return m, nil
+}
+
+// verifyBundle verifies the signature of a sigstore bundle. Message
+// signatures are only verified if they are over subject.
+func (tr *TrustedRoot) verifyBundle(b *sigstoreBundle, subject digest.Digest) (*Identity, error) {
+	var msg, payloadDigest, sig []byte
+	verifyFn := verifySignature
+
+	switch {
+	case b.DSSEEnvelope != nil:
+		env := b.DSSEEnvelope
+		if len(env.Signatures) == 0 {
+			return nil, errors.New("dsse envelope has no signature")
+		}
+		payload, err := decodeBase64(env.Payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode dsse payload")
+		}
+		sig, err = decodeBase64(env.Signatures[0].Sig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode dsse signature")
+		}
+		h := sha256.Sum256(payload)
+		msg, payloadDigest = pae(env.PayloadType, payload), h[:]
+	case b.MessageSignature != nil:
+		md := b.MessageSignature.MessageDigest
+		if md.Algorithm != "SHA2_256" || subject.Algorithm() != digest.SHA256 || hex.EncodeToString(md.Digest) != subject.Hex() {
+			return nil, errors.New("message signature is not over the subject digest")
+		}
+		msg, payloadDigest, sig = md.Digest, md.Digest, b.MessageSignature.Signature
+		verifyFn = verifyDigest
+	default:
+		return nil, errors.New("sigstore bundle has no signature")
+	}
+
+	m, err := b.material()
+	if err != nil {
+		return nil, err
+	}
+	return tr.verify(*m, func(pub crypto.PublicKey) error {
+		return verifyFn(pub, msg, sig)
+	}, func(body []byte) error {
+		return checkRekorBody(body, payloadDigest, sig)
+	})
+}
+
+// scanSigstoreBundle adds the signature of a sigstore bundle referring to
+// subject to img, along with the attestation for bundles holding a DSSE
+// envelope. Message signatures are only verified if they are over the
+// subject digest.
+func (l *Loader) scanSigstoreBundle(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor, subject digest.Digest, img *Image) error {
+	dt, err := l.readBlob(ctx, fetcher, layer)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch sigstore bundle %s", layer.Digest)
+	}
+
+	var b sigstoreBundle
+	if err := json.Unmarshal(dt, &b); err != nil {
+		return errors.Wrapf(err, "failed to decode sigstore bundle %s", layer.Digest)
+	}
+
+	s := Signature{
+		Type:    SignatureTypeSigstore,
+		Subject: subject,
+	}
+
+	var stmt *inTotoStatement
+	if env := b.DSSEEnvelope; env != nil && env.PayloadType == MediaTypeInToto {
+		payload, err := decodeBase64(env.Payload)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode sigstore bundle %s", layer.Digest)
+		}
+		stmt, err = decodeStatement(payload, subject)
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.opt.TrustedRoot != nil {
+		id, err := l.opt.TrustedRoot.verifyBundle(&b, subject)
+		if err == nil {
+			s.Verified = true
+			s.Identity = *id
+		} else {
+			s.Error = err.Error()
+		}
+	}
+
+	if l.want(PartSignatures) {
+		img.Signatures = append(img.Signatures, s)
+	}
+	if stmt != nil {
+		return l.addStatement(img, stmt, []Signature{s})
+	}
+	return nil
+}
+
+// verifyDigest verifies sig over a precomputed sha256 digest.
+func verifyDigest(pub crypto.PublicKey, digest []byte, sig []byte) error {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(pub, digest, sig) {
+			return nil
+		}
+		return errors.New("invalid ecdsa signature")
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig); err == nil {
+			return nil
+		}
+		return rsa.VerifyPSS(pub, crypto.SHA256, digest, sig, nil)
+	case ed25519.PublicKey:
+		return errors.New("ed25519 signatures over digests are not supported")
+	}
+	return errors.Errorf("unsupported public key type %T", pub)
+}
@@ -0,0 +1,789 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageinspect
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-imageinspect/testutil"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	testWorkflow = "https://github.com/docker/go-imageinspect/.github/workflows/release.yml@refs/heads/main"
+	testIssuer   = "https://token.actions.githubusercontent.com"
+)
+
+// testSigstore is a certificate authority and transparency log for testing
+// keyless signatures.
+type testSigstore struct {
+	t *testing.T
+
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	leaf   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	log    *ecdsa.PrivateKey
+	logID  []byte
+	ct     *ecdsa.PrivateKey
+	signed time.Time
+
+	// precert is leaf without its signed certificate timestamp
+	precert *x509.Certificate
+}
+
+func newTestSigstore(t *testing.T) *testSigstore {
+	s := &testSigstore{
+		t:      t,
+		signed: time.Now().Add(-time.Hour).Truncate(time.Second),
+	}
+
+	var err error
+	s.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-fulcio"},
+		NotBefore:             s.signed.Add(-24 * time.Hour),
+		NotAfter:              s.signed.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	dt, err := x509.CreateCertificate(rand.Reader, ca, ca, &s.caKey.PublicKey, s.caKey)
+	require.NoError(t, err)
+	s.ca, err = x509.ParseCertificate(dt)
+	require.NoError(t, err)
+
+	s.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	issuer, err := asn1.Marshal(testIssuer)
+	require.NoError(t, err)
+	u, err := url.Parse(testWorkflow)
+	require.NoError(t, err)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		// Fulcio certificates are only valid for a few minutes
+		NotBefore:   s.signed.Add(-time.Minute),
+		NotAfter:    s.signed.Add(9 * time.Minute),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:        []*url.URL{u},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}, Value: issuer},
+		},
+	}
+	dt, err = x509.CreateCertificate(rand.Reader, leaf, s.ca, &s.key.PublicKey, s.caKey)
+	require.NoError(t, err)
+	s.precert, err = x509.ParseCertificate(dt)
+	require.NoError(t, err)
+
+	// the SCT extension is added last, so the TBSCertificate of precert is
+	// the one of leaf without it
+	s.ct, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ctKey, err := x509.MarshalPKIXPublicKey(&s.ct.PublicKey)
+	require.NoError(t, err)
+	ctID := sha256.Sum256(ctKey)
+	sct := signedCertificateTimestamp{
+		logID:     ctID[:],
+		timestamp: uint64(s.signed.Add(-time.Minute).UnixMilli()),
+	}
+	issuerKeyHash := sha256.Sum256(s.ca.RawSubjectPublicKeyInfo)
+	h := sha256.Sum256(sct.signedData(issuerKeyHash[:], s.precert.RawTBSCertificate))
+	sct.signature, err = s.ct.Sign(rand.Reader, h[:], crypto.SHA256)
+	require.NoError(t, err)
+
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(0)
+			b.AddBytes(sct.logID)
+			b.AddUint64(sct.timestamp)
+			b.AddUint16(0)
+			b.AddUint8(4) // sha256
+			b.AddUint8(3) // ecdsa
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(sct.signature)
+			})
+		})
+	})
+	sctList, err := asn1.Marshal(b.BytesOrPanic())
+	require.NoError(t, err)
+	leaf.ExtraExtensions = append(leaf.ExtraExtensions, pkix.Extension{Id: oidSCTList, Value: sctList})
+
+	dt, err = x509.CreateCertificate(rand.Reader, leaf, s.ca, &s.key.PublicKey, s.caKey)
+	require.NoError(t, err)
+	s.leaf, err = x509.ParseCertificate(dt)
+	require.NoError(t, err)
+
+	s.log, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	logKey, err := x509.MarshalPKIXPublicKey(&s.log.PublicKey)
+	require.NoError(t, err)
+	h = sha256.Sum256(logKey)
+	s.logID = h[:]
+
+	return s
+}
+
+func (s *testSigstore) trustedRoot() *TrustedRoot {
+	logKey, err := x509.MarshalPKIXPublicKey(&s.log.PublicKey)
+	require.NoError(s.t, err)
+	ctKey, err := x509.MarshalPKIXPublicKey(&s.ct.PublicKey)
+	require.NoError(s.t, err)
+
+	dt, err := json.Marshal(map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.trustedroot+json;version=0.1",
+		"tlogs": []interface{}{
+			map[string]interface{}{
+				"baseUrl":       "https://rekor.test",
+				"hashAlgorithm": "SHA2_256",
+				"publicKey": map[string]interface{}{
+					"rawBytes":   logKey,
+					"keyDetails": "PKIX_ECDSA_P256_SHA_256",
+					"validFor":   map[string]interface{}{"start": s.signed.Add(-24 * time.Hour)},
+				},
+				"logId": map[string]interface{}{"keyId": s.logID},
+			},
+		},
+		"ctlogs": []interface{}{
+			map[string]interface{}{
+				"baseUrl":       "https://ctfe.test",
+				"hashAlgorithm": "SHA2_256",
+				"publicKey": map[string]interface{}{
+					"rawBytes":   ctKey,
+					"keyDetails": "PKIX_ECDSA_P256_SHA_256",
+					"validFor":   map[string]interface{}{"start": s.signed.Add(-24 * time.Hour)},
+				},
+			},
+		},
+		"certificateAuthorities": []interface{}{
+			map[string]interface{}{
+				"uri": "https://fulcio.test",
+				"certChain": map[string]interface{}{
+					"certificates": []interface{}{
+						map[string]interface{}{"rawBytes": s.ca.Raw},
+					},
+				},
+				"validFor": map[string]interface{}{"start": s.signed.Add(-24 * time.Hour)},
+			},
+		},
+	})
+	require.NoError(s.t, err)
+
+	tr, err := ParseTrustedRoot(dt)
+	require.NoError(s.t, err)
+	return tr
+}
+
+func (s *testSigstore) sign(dt []byte) []byte {
+	h := sha256.Sum256(dt)
+	sig, err := s.key.Sign(rand.Reader, h[:], crypto.SHA256)
+	require.NoError(s.t, err)
+	return sig
+}
+
+func (s *testSigstore) logSign(dt []byte) []byte {
+	h := sha256.Sum256(dt)
+	sig, err := s.log.Sign(rand.Reader, h[:], crypto.SHA256)
+	require.NoError(s.t, err)
+	return sig
+}
+
+// rekorBody returns the hashedrekord entry for sig over a payload with the
+// given sha256 digest.
+func (s *testSigstore) rekorBody(payloadDigest []byte, sig []byte) []byte {
+	dt, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]interface{}{
+			"data": map[string]interface{}{
+				"hash": map[string]string{
+					"algorithm": "sha256",
+					"value":     hex.EncodeToString(payloadDigest),
+				},
+			},
+			"signature": map[string]interface{}{
+				"content": base64.StdEncoding.EncodeToString(sig),
+				"publicKey": map[string]string{
+					"content": base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.leaf.Raw})),
+				},
+			},
+		},
+	})
+	require.NoError(s.t, err)
+	return dt
+}
+
+func TestCosignKeyless(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSigstore(t)
+
+	for _, tc := range []struct {
+		name     string
+		tamper   bool
+		verified bool
+	}{
+		{name: "valid", verified: true},
+		{name: "tampered", tamper: true, verified: false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			env := testutil.NewEnv(t)
+
+			var annotations map[string]string
+			cosignImage(t, env, func(payload []byte) []byte {
+				sig := s.sign(payload)
+				h := sha256.Sum256(payload)
+				body := s.rekorBody(h[:], sig)
+
+				integratedTime := s.signed.Unix()
+				logID := hex.EncodeToString(s.logID)
+				canonical, err := json.Marshal(map[string]interface{}{
+					"body":           base64.StdEncoding.EncodeToString(body),
+					"integratedTime": integratedTime,
+					"logID":          logID,
+					"logIndex":       42,
+				})
+				require.NoError(t, err)
+				set := s.logSign(canonical)
+				if tc.tamper {
+					integratedTime++
+				}
+
+				bundle, err := json.Marshal(map[string]interface{}{
+					"SignedEntryTimestamp": set,
+					"Payload": map[string]interface{}{
+						"body":           base64.StdEncoding.EncodeToString(body),
+						"integratedTime": integratedTime,
+						"logIndex":       42,
+						"logID":          logID,
+					},
+				})
+				require.NoError(t, err)
+
+				annotations = map[string]string{
+					"dev.sigstore.cosign/certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.leaf.Raw})),
+					"dev.sigstore.cosign/chain":       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.Raw})),
+					"dev.sigstore.cosign/bundle":      string(bundle),
+				}
+				return sig
+			}, func(a map[string]string) {
+				for k, v := range annotations {
+					a[k] = v
+				}
+			})
+
+			l, err := NewLoader(Opt{
+				Resolver:    env,
+				Cosign:      true,
+				TrustedRoot: s.trustedRoot(),
+			})
+			require.NoError(t, err)
+
+			r, err := l.Load(ctx, "test")
+			require.NoError(t, err)
+
+			img := r.Images["linux/amd64"]
+			require.Equal(t, 1, len(img.Signatures))
+
+			sig := img.Signatures[0]
+			require.Equal(t, tc.verified, sig.Verified)
+			if tc.verified {
+				require.Equal(t, Identity{
+					Subject:  testWorkflow,
+					Issuer:   testIssuer,
+					LogIndex: 42,
+				}, sig.Identity)
+			} else {
+				require.Equal(t, Identity{}, sig.Identity)
+				require.Contains(t, sig.Error, "failed to verify signed entry timestamp")
+			}
+		})
+	}
+}
+
+func TestCosignKeylessAttestation(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSigstore(t)
+
+	for _, tc := range []struct {
+		name   string
+		tamper bool
+		err    string
+	}{
+		{name: "valid"},
+		{name: "tampered", tamper: true, err: "failed to verify signed entry timestamp"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			env := testutil.NewEnv(t)
+
+			mfst := cosignImage(t, env, func([]byte) []byte {
+				return []byte("signature")
+			})
+
+			stmt, err := testutil.Statement(mfst.Descriptor, "https://slsa.dev/provenance/v0.2", map[string]interface{}{
+				"builder": map[string]string{"id": "https://example.com/builder"},
+			})
+			require.NoError(t, err)
+			var sig []byte
+			envelope, err := testutil.Envelope(stmt, "", func(dt []byte) []byte {
+				sig = s.sign(dt)
+				return sig
+			})
+			require.NoError(t, err)
+
+			h := sha256.Sum256(stmt.Data)
+			body, err := json.Marshal(map[string]interface{}{
+				"apiVersion": "0.0.1",
+				"kind":       "dsse",
+				"spec": map[string]interface{}{
+					"payloadHash": map[string]string{
+						"algorithm": "sha256",
+						"value":     hex.EncodeToString(h[:]),
+					},
+					"signatures": []interface{}{
+						map[string]string{"signature": base64.StdEncoding.EncodeToString(sig)},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			integratedTime := s.signed.Unix()
+			logID := hex.EncodeToString(s.logID)
+			canonical, err := json.Marshal(map[string]interface{}{
+				"body":           base64.StdEncoding.EncodeToString(body),
+				"integratedTime": integratedTime,
+				"logID":          logID,
+				"logIndex":       43,
+			})
+			require.NoError(t, err)
+			set := s.logSign(canonical)
+			if tc.tamper {
+				integratedTime++
+			}
+			bundle, err := json.Marshal(map[string]interface{}{
+				"SignedEntryTimestamp": set,
+				"Payload": map[string]interface{}{
+					"body":           base64.StdEncoding.EncodeToString(body),
+					"integratedTime": integratedTime,
+					"logIndex":       43,
+					"logID":          logID,
+				},
+			})
+			require.NoError(t, err)
+
+			envelope.Descriptor.Annotations = map[string]string{
+				"predicateType":                   "https://slsa.dev/provenance/v0.2",
+				"dev.sigstore.cosign/certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.leaf.Raw})),
+				"dev.sigstore.cosign/chain":       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.Raw})),
+				"dev.sigstore.cosign/bundle":      string(bundle),
+			}
+			_, err = env.AddBlob(envelope)
+			require.NoError(t, err)
+
+			att, err := testutil.Manifest(ocispec.Manifest{
+				Config: ocispec.Descriptor{
+					Digest: digest.FromString("{}"),
+					Size:   2,
+				},
+				Layers: []ocispec.Descriptor{envelope.Descriptor},
+			})
+			require.NoError(t, err)
+			_, err = env.AddBlob(att)
+			require.NoError(t, err)
+			require.NoError(t, env.AddTag("docker.io/library/test:sha256-"+mfst.Descriptor.Digest.Hex()+".att", att.Descriptor.Digest))
+
+			l, err := NewLoader(Opt{
+				Resolver:    env,
+				Cosign:      true,
+				TrustedRoot: s.trustedRoot(),
+			})
+			require.NoError(t, err)
+
+			r, err := l.Load(ctx, "test")
+			require.NoError(t, err)
+
+			img := r.Images["linux/amd64"]
+			require.NotNil(t, img.Provenance)
+			require.Equal(t, "https://example.com/builder", img.Provenance.BuilderID)
+
+			expected := Signature{
+				Type:    SignatureTypeDSSE,
+				Subject: mfst.Descriptor.Digest,
+			}
+			if tc.err == "" {
+				expected.Verified = true
+				expected.Identity = Identity{
+					Subject:  testWorkflow,
+					Issuer:   testIssuer,
+					LogIndex: 43,
+				}
+			}
+
+			sigs := img.Provenance.Signatures
+			require.Equal(t, 1, len(sigs))
+			if tc.err != "" {
+				require.Contains(t, sigs[0].Error, tc.err)
+				sigs[0].Error = ""
+			}
+			require.Equal(t, []Signature{expected}, sigs)
+		})
+	}
+}
+
+func TestSigstoreBundle(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSigstore(t)
+
+	for _, tc := range []struct {
+		name        string
+		noSET       bool
+		tamperTime  bool
+		tamperProof bool
+		noRoot      bool
+		noSCT       bool
+		err         string
+	}{
+		{name: "valid"},
+		{name: "no signed certificate timestamp", noSCT: true, err: "signing certificate has no signed certificate timestamp"},
+		{name: "proof only", noSET: true, err: "transparency log entry has no signed entry timestamp"},
+		{name: "tampered integrated time", tamperTime: true, err: "failed to verify signed entry timestamp"},
+		{name: "tampered proof", tamperProof: true, err: "inclusion proof does not match root hash"},
+		{name: "no trusted root", noRoot: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			env := testutil.NewEnv(t)
+			env.SetReferrersAPI(true)
+
+			cfg, err := testutil.Config(ocispec.Image{})
+			require.NoError(t, err)
+			_, err = env.AddBlob(cfg)
+			require.NoError(t, err)
+
+			mfst, err := testutil.Manifest(ocispec.Manifest{
+				Config: cfg.Descriptor,
+			})
+			require.NoError(t, err)
+			_, err = env.AddBlob(mfst)
+			require.NoError(t, err)
+
+			require.NoError(t, env.AddTag("docker.io/library/test:latest", mfst.Descriptor.Digest))
+
+			dgst, err := hex.DecodeString(mfst.Descriptor.Digest.Hex())
+			require.NoError(t, err)
+			sig, err := s.key.Sign(rand.Reader, dgst, crypto.SHA256)
+			require.NoError(t, err)
+			body := s.rekorBody(dgst, sig)
+
+			// two entry tree with the signature at index 0
+			leaf := func(dt []byte) []byte {
+				h := sha256.Sum256(append([]byte{0}, dt...))
+				return h[:]
+			}
+			sibling := leaf([]byte("other entry"))
+			root := hashChildren(leaf(body), sibling)
+
+			note := fmt.Sprintf("rekor.test - 1\n2\n%s\n", base64.StdEncoding.EncodeToString(root))
+			noteSig := append(append([]byte{}, s.logID[:4]...), s.logSign([]byte(note))...)
+			checkpoint := note + "\n— rekor.test " + base64.StdEncoding.EncodeToString(noteSig) + "\n"
+
+			integratedTime := s.signed.Unix()
+			canonical, err := json.Marshal(map[string]interface{}{
+				"body":           base64.StdEncoding.EncodeToString(body),
+				"integratedTime": integratedTime,
+				"logID":          hex.EncodeToString(s.logID),
+				"logIndex":       7,
+			})
+			require.NoError(t, err)
+			set := s.logSign(canonical)
+
+			if tc.tamperTime {
+				// backdate the signature to before the certificate expired
+				integratedTime -= 3600
+			}
+			if tc.tamperProof {
+				sibling = leaf([]byte("tampered entry"))
+			}
+
+			entry := map[string]interface{}{
+				"logIndex":       "7",
+				"logId":          map[string]interface{}{"keyId": s.logID},
+				"kindVersion":    map[string]string{"kind": "hashedrekord", "version": "0.0.1"},
+				"integratedTime": fmt.Sprint(integratedTime),
+				"inclusionProof": map[string]interface{}{
+					"logIndex":   "0",
+					"rootHash":   root,
+					"treeSize":   "2",
+					"hashes":     [][]byte{sibling},
+					"checkpoint": map[string]string{"envelope": checkpoint},
+				},
+				"canonicalizedBody": body,
+			}
+			if !tc.noSET {
+				entry["inclusionPromise"] = map[string]interface{}{"signedEntryTimestamp": set}
+			}
+
+			cert := s.leaf
+			if tc.noSCT {
+				cert = s.precert
+			}
+
+			bundle, err := json.Marshal(map[string]interface{}{
+				"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+				"verificationMaterial": map[string]interface{}{
+					"certificate": map[string]interface{}{"rawBytes": cert.Raw},
+					"tlogEntries": []interface{}{entry},
+				},
+				"messageSignature": map[string]interface{}{
+					"messageDigest": map[string]interface{}{
+						"algorithm": "SHA2_256",
+						"digest":    dgst,
+					},
+					"signature": sig,
+				},
+			})
+			require.NoError(t, err)
+			bundleBlob := &testutil.Blob{
+				Data: bundle,
+				Descriptor: ocispec.Descriptor{
+					MediaType: "application/vnd.dev.sigstore.bundle.v0.3+json",
+					Digest:    digest.FromBytes(bundle),
+					Size:      int64(len(bundle)),
+				},
+			}
+			_, err = env.AddBlob(bundleBlob)
+			require.NoError(t, err)
+
+			artifact, err := testutil.Manifest(ocispec.Manifest{
+				Config: ocispec.Descriptor{
+					MediaType: "application/vnd.oci.empty.v1+json",
+					Digest:    digest.FromString("{}"),
+					Size:      2,
+				},
+				Layers: []ocispec.Descriptor{bundleBlob.Descriptor},
+			})
+			require.NoError(t, err)
+			_, err = env.AddBlob(artifact)
+			require.NoError(t, err)
+			env.AddReferrer(mfst.Descriptor.Digest, artifact.Descriptor)
+
+			opt := Opt{
+				Resolver: env,
+			}
+			if !tc.noRoot {
+				opt.TrustedRoot = s.trustedRoot()
+			}
+			l, err := NewLoader(opt)
+			require.NoError(t, err)
+
+			r, err := l.Load(ctx, "test")
+			require.NoError(t, err)
+
+			expected := Signature{
+				Type:    SignatureTypeSigstore,
+				Subject: mfst.Descriptor.Digest,
+			}
+			switch {
+			case tc.noRoot:
+				// without a trusted root the signature is reported but not verified
+			case tc.err != "":
+				expected.Error = tc.err
+			default:
+				expected.Verified = true
+				expected.Identity = Identity{
+					Subject:  testWorkflow,
+					Issuer:   testIssuer,
+					LogIndex: 7,
+				}
+			}
+
+			img := r.Images["linux/amd64"]
+			require.Equal(t, 1, len(img.Signatures))
+			if tc.err != "" {
+				require.Contains(t, img.Signatures[0].Error, tc.err)
+				img.Signatures[0].Error = tc.err
+			}
+			require.Equal(t, []Signature{expected}, img.Signatures)
+		})
+	}
+}
+
+// TestSigstoreConformance verifies bundles from the sigstore-go test vectors.
+func TestSigstoreConformance(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		root    string
+		bundle  string
+		subject digest.Digest
+		tamper  func(string) string
+		trust   func(*TrustedRoot)
+		id      Identity
+		err     string
+	}{
+		{
+			name:   "provenance",
+			root:   "public-good.json",
+			bundle: "sigstore-js-provenance.sigstore.json",
+			id: Identity{
+				Subject:  "https://github.com/sigstore/sigstore-js/.github/workflows/release.yml@refs/heads/main",
+				Issuer:   "https://token.actions.githubusercontent.com",
+				LogIndex: 31821305,
+			},
+		},
+		{
+			name:   "dsse",
+			root:   "public-good.json",
+			bundle: "dsse.sigstore.json",
+			id: Identity{
+				Subject:  "brian@dehamer.com",
+				Issuer:   "https://github.com/login/oauth",
+				LogIndex: 6800908,
+			},
+		},
+		{
+			name:    "message signature",
+			root:    "scaffolding.json",
+			bundle:  "othername.sigstore.json",
+			subject: "sha256:bc103b4a84971ef6459b294a2b98568a2bfb72cded09d4acd1e16366a401f95b",
+			id: Identity{
+				Subject:  "foo!oidc.local",
+				Issuer:   "http://oidc.local:8080",
+				LogIndex: 3,
+			},
+		},
+		{
+			name:    "message signature for other digest",
+			root:    "scaffolding.json",
+			bundle:  "othername.sigstore.json",
+			subject: digest.FromString("other"),
+			err:     "message signature is not over the subject digest",
+		},
+		{
+			name:   "untrusted root",
+			root:   "scaffolding.json",
+			bundle: "sigstore-js-provenance.sigstore.json",
+			err:    "unknown transparency log",
+		},
+		{
+			name:   "tampered integrated time",
+			root:   "public-good.json",
+			bundle: "sigstore-js-provenance.sigstore.json",
+			tamper: func(s string) string {
+				return strings.Replace(s, `"integratedTime": "1692374735"`, `"integratedTime": "1692374734"`, 1)
+			},
+			err: "failed to verify signed entry timestamp",
+		},
+		{
+			name:   "untrusted certificate transparency log",
+			root:   "public-good.json",
+			bundle: "sigstore-js-provenance.sigstore.json",
+			trust: func(tr *TrustedRoot) {
+				ctlogs := map[string]transparencyLog{}
+				for _, ctlog := range tr.ctlogs {
+					ctlogs[strings.Repeat("00", 32)] = ctlog
+				}
+				tr.ctlogs = ctlogs
+			},
+			err: "no signed certificate timestamp from a trusted certificate transparency log",
+		},
+		{
+			name:   "wrong certificate transparency log key",
+			root:   "public-good.json",
+			bundle: "sigstore-js-provenance.sigstore.json",
+			trust: func(tr *TrustedRoot) {
+				for id, ctlog := range tr.ctlogs {
+					for _, tlog := range tr.tlogs {
+						ctlog.key = tlog.key
+					}
+					tr.ctlogs[id] = ctlog
+				}
+			},
+			err: "failed to verify signed certificate timestamp",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dt, err := os.ReadFile(filepath.Join("testdata", "sigstore", tc.root))
+			require.NoError(t, err)
+			tr, err := ParseTrustedRoot(dt)
+			require.NoError(t, err)
+			if tc.trust != nil {
+				tc.trust(tr)
+			}
+
+			dt, err = os.ReadFile(filepath.Join("testdata", "sigstore", tc.bundle))
+			require.NoError(t, err)
+			if tc.tamper != nil {
+				tampered := tc.tamper(string(dt))
+				require.NotEqual(t, string(dt), tampered)
+				dt = []byte(tampered)
+			}
+			var b sigstoreBundle
+			require.NoError(t, json.Unmarshal(dt, &b))
+
+			id, err := tr.verifyBundle(&b, tc.subject)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.id, *id)
+		})
+	}
+}
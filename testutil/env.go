@@ -19,9 +19,11 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"strings"
 	"sync"
 	"testing"
 
+	"github.com/containerd/containerd/errdefs"
 	distref "github.com/containerd/containerd/reference/docker"
 	"github.com/containerd/containerd/remotes"
 	"github.com/moby/buildkit/util/imageutil"
@@ -38,24 +40,29 @@ type Blob struct {
 type Env struct {
 	t *testing.T
 
-	mu    sync.Mutex
-	blobs map[digest.Digest][]byte
-	tags  map[string]digest.Digest
+	mu           sync.Mutex
+	blobs        map[digest.Digest][]byte
+	tags         map[string]digest.Digest
+	referrers    map[digest.Digest][]ocispec.Descriptor
+	referrersAPI bool
 }
 
 func NewEnv(t *testing.T) *Env {
 	return &Env{
-		t:     t,
-		blobs: map[digest.Digest][]byte{},
-		tags:  map[string]digest.Digest{},
+		t:         t,
+		blobs:     map[digest.Digest][]byte{},
+		tags:      map[string]digest.Digest{},
+		referrers: map[digest.Digest][]ocispec.Descriptor{},
 	}
 }
 
 func (e *Env) AddBlob(b *Blob) (digest.Digest, error) {
-	// validate JSON to error early
-	m := map[string]interface{}{}
-	if err := json.Unmarshal(b.Data, &m); err != nil {
-		return "", err
+	// validate JSON to error early, other blobs are stored as is
+	if b.Descriptor.MediaType == "" || strings.HasSuffix(b.Descriptor.MediaType, "json") {
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(b.Data, &m); err != nil {
+			return "", err
+		}
 	}
 
 	dgst := digest.FromBytes(b.Data)
@@ -83,13 +90,38 @@ func (e *Env) AddTag(ref string, dgst digest.Digest) error {
 	return nil
 }
 
+// AddReferrer registers desc as a referrer of subject, returned through
+// the referrers API if enabled with SetReferrersAPI.
+func (e *Env) AddReferrer(subject digest.Digest, desc ocispec.Descriptor) {
+	e.mu.Lock()
+	e.referrers[subject] = append(e.referrers[subject], desc)
+	e.mu.Unlock()
+	e.t.Logf("added referrer %s -> %s", desc.Digest, subject)
+}
+
+func (e *Env) SetReferrersAPI(enabled bool) {
+	e.mu.Lock()
+	e.referrersAPI = enabled
+	e.mu.Unlock()
+}
+
+func (e *Env) FetchReferrers(ctx context.Context, ref string, dgst digest.Digest) ([]ocispec.Descriptor, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.referrersAPI {
+		return nil, errors.Wrap(errdefs.ErrNotFound, "referrers api not available")
+	}
+	return e.referrers[dgst], nil
+}
+
 func (e *Env) Resolve(ctx context.Context, ref string) (name string, desc ocispec.Descriptor, err error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	dgst, ok := e.tags[ref]
 	if !ok {
-		return "", ocispec.Descriptor{}, errors.Errorf("tag %s not found", ref)
+		return "", ocispec.Descriptor{}, errors.Wrapf(errdefs.ErrNotFound, "tag %s not found", ref)
 	}
 
 	dt, ok := e.blobs[dgst]
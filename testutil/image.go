@@ -15,7 +15,9 @@
 package testutil
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -110,3 +112,98 @@ func Index(idx ocispec.Index) (*Blob, error) {
 		},
 	}, nil
 }
+
+func Statement(subject ocispec.Descriptor, predicateType string, predicate interface{}) (*Blob, error) {
+	pred, err := json.Marshal(predicate)
+	if err != nil {
+		return nil, err
+	}
+
+	dt, err := json.Marshal(map[string]interface{}{
+		"_type":         "https://in-toto.io/Statement/v0.1",
+		"predicateType": predicateType,
+		"subject": []interface{}{
+			map[string]interface{}{
+				"name": "_",
+				"digest": map[string]string{
+					subject.Digest.Algorithm().String(): subject.Digest.Hex(),
+				},
+			},
+		},
+		"predicate": json.RawMessage(pred),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Blob{
+		Data: dt,
+		Descriptor: ocispec.Descriptor{
+			MediaType: "application/vnd.in-toto+json",
+			Digest:    digest.FromBytes(dt),
+			Size:      int64(len(dt)),
+			Annotations: map[string]string{
+				"in-toto.io/predicate-type": predicateType,
+			},
+		},
+	}, nil
+}
+
+func AttestationManifest(subject ocispec.Descriptor, layers ...ocispec.Descriptor) (*Blob, error) {
+	cfg, err := Config(ocispec.Image{})
+	if err != nil {
+		return nil, err
+	}
+
+	mfst, err := Manifest(ocispec.Manifest{
+		Config: cfg.Descriptor,
+		Layers: layers,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mfst.Descriptor.Platform = &ocispec.Platform{
+		OS:           "unknown",
+		Architecture: "unknown",
+	}
+	mfst.Descriptor.Annotations = map[string]string{
+		"vnd.docker.reference.digest": subject.Digest.String(),
+		"vnd.docker.reference.type":   "attestation-manifest",
+	}
+	return mfst, nil
+}
+
+// Envelope wraps the statement stmt in a DSSE envelope. The pre-authentication
+// encoding of the statement is signed with sign, unless sign is nil.
+func Envelope(stmt *Blob, keyID string, sign func([]byte) []byte) (*Blob, error) {
+	const payloadType = "application/vnd.in-toto+json"
+
+	sigs := []interface{}{}
+	if sign != nil {
+		pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(stmt.Data), stmt.Data)
+		sigs = append(sigs, map[string]string{
+			"keyid": keyID,
+			"sig":   base64.StdEncoding.EncodeToString(sign([]byte(pae))),
+		})
+	}
+
+	dt, err := json.Marshal(map[string]interface{}{
+		"payloadType": payloadType,
+		"payload":     base64.StdEncoding.EncodeToString(stmt.Data),
+		"signatures":  sigs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Blob{
+		Data: dt,
+		Descriptor: ocispec.Descriptor{
+			MediaType:   "application/vnd.dsse.envelope.v1+json",
+			Digest:      digest.FromBytes(dt),
+			Size:        int64(len(dt)),
+			Annotations: stmt.Descriptor.Annotations,
+		},
+	}, nil
+}
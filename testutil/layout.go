@@ -0,0 +1,110 @@
+// Copyright 2022 go-imageinspect authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// LayoutFiles returns the files of an OCI image layout holding idx as
+// index.json and the given blobs.
+func LayoutFiles(idx ocispec.Index, blobs ...*Blob) (map[string][]byte, error) {
+	if idx.SchemaVersion == 0 {
+		idx.SchemaVersion = 2
+	}
+	for i, m := range idx.Manifests {
+		if m.MediaType == "" {
+			m.MediaType = ocispec.MediaTypeImageManifest
+		}
+		idx.Manifests[i] = m
+	}
+
+	layout, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+	index, err := json.Marshal(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		ocispec.ImageLayoutFile: layout,
+		"index.json":            index,
+	}
+	for _, b := range blobs {
+		files["blobs/"+b.Descriptor.Digest.Algorithm().String()+"/"+b.Descriptor.Digest.Hex()] = b.Data
+	}
+	return files, nil
+}
+
+// WriteLayout writes an OCI image layout holding idx as index.json and the
+// given blobs to dir.
+func WriteLayout(dir string, idx ocispec.Index, blobs ...*Blob) error {
+	files, err := LayoutFiles(idx, blobs...)
+	if err != nil {
+		return err
+	}
+	for name, dt := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, dt, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteArchive writes files to a tar archive at p.
+func WriteArchive(p string, files map[string][]byte) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(f)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(files[name])),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -14,7 +14,12 @@
 
 package imageinspect
 
-import "github.com/opencontainers/go-digest"
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+)
 
 type ResultType string
 
@@ -30,16 +35,100 @@ type Result struct {
 	Platforms  []string
 	Images     map[string]Image
 
+	// GeneratedManifest is set when the source had no manifest for the
+	// image and generated one, as for "docker save" archives without an
+	// index.json. Digest and the layers then don't match the pushed image.
+	GeneratedManifest bool `json:",omitempty"`
+
+	// Errors are the failures that aren't specific to a single image, only
+	// collected with Opt.Lenient.
+	Errors []Error `json:",omitempty"`
+
 	// Signature summary
 }
 
+type Component string
+
+const (
+	ComponentManifest    Component = "manifest"
+	ComponentConfig      Component = "config"
+	ComponentReferrers   Component = "referrers"
+	ComponentAttestation Component = "attestation"
+	ComponentSignature   Component = "signature"
+	ComponentProvenance  Component = "provenance"
+	ComponentLayers      Component = "layers"
+)
+
+// Error is a failure to read part of the metadata of an image.
+type Error struct {
+	Component Component
+	// Digest is the digest of the blob that failed to be read.
+	Digest digest.Digest
+	Cause  error
+}
+
+func (e Error) Error() string {
+	if e.Digest == "" {
+		return fmt.Sprintf("%s: %v", e.Component, e.Cause)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Component, e.Digest, e.Cause)
+}
+
+func (e Error) Unwrap() error {
+	return e.Cause
+}
+
+func (e Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Component Component
+		Digest    digest.Digest `json:",omitempty"`
+		Cause     string
+	}{
+		Component: e.Component,
+		Digest:    e.Digest,
+		Cause:     e.Cause.Error(),
+	})
+}
+
 type Identity struct {
-	PublicKey string
+	// PublicKey is the PEM encoded public key the signature was verified
+	// with.
+	PublicKey string `json:",omitempty"`
+
+	// Subject is the email, URI or username of the keyless signing
+	// certificate, or the subject DN of the notation signing certificate.
+	Subject string `json:",omitempty"`
+	// Issuer is the OIDC issuer that authenticated Subject, or the issuer
+	// DN of the notation signing certificate.
+	Issuer string `json:",omitempty"`
+	// LogIndex is the index of the signature in the transparency log.
+	LogIndex int64 `json:",omitempty"`
+
+	// KeyID is the key hint of a DSSE envelope signature.
+	KeyID string `json:",omitempty"`
 	// ...
 }
 
+type SignatureType string
+
+const (
+	SignatureTypeCosign   SignatureType = "cosign"
+	SignatureTypeSigstore SignatureType = "sigstore"
+	SignatureTypeDSSE     SignatureType = "dsse"
+	SignatureTypeNotation SignatureType = "notation"
+)
+
 type Signature struct {
+	Type SignatureType `json:",omitempty"`
+	// Subject is the digest of the signed manifest, which is the index
+	// for signatures covering all platforms.
+	Subject  digest.Digest `json:",omitempty"`
 	Verified bool
+	// Error is the reason verification failed, if it was attempted.
+	Error string `json:",omitempty"`
+	// Warnings are the verification failures that the trust policy only
+	// reports, such as an expired certificate at the permissive level.
+	Warnings []string `json:",omitempty"`
 	Identity Identity
 }
 
@@ -56,11 +145,27 @@ type Image struct {
 	Description      string
 	License          string
 	Size             int64
+	// UncompressedSize is only computed with Opt.UncompressedSize.
+	UncompressedSize int64 `json:",omitempty"`
+
+	Config  *Config   `json:",omitempty"`
+	Layers  []Layer   `json:",omitempty"`
+	History []History `json:",omitempty"`
+	// Files are the files of the image filesystem once all layers are
+	// applied, only listed with Opt.Files.
+	Files []File `json:",omitempty"`
+	// Secrets are the files of the layers that likely contain secrets, only
+	// looked for with Opt.Secrets.
+	Secrets []Secret `json:",omitempty"`
 
 	Signatures []Signature
 	SBOM       *SBOM       `json:",omitempty"`
 	Provenance *Provenance `json:",omitempty"`
 
+	// Errors are the failures to read parts of the image metadata, only
+	// collected with Opt.Lenient.
+	Errors []Error `json:",omitempty"`
+
 	// Build logs
 	// Hub identity
 }